@@ -0,0 +1,74 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"math/rand"
+	"time"
+)
+
+// reconnectBackoff computes the delay before each reconnect attempt. The
+// delay grows by factor after every failed attempt up to max, and each delay
+// is spread by ±jitter so clients of a restarted publisher do not retry in
+// lockstep. It is not safe for concurrent use.
+type reconnectBackoff struct {
+	initial time.Duration
+	max     time.Duration
+	factor  float64
+	jitter  float64
+
+	current time.Duration
+}
+
+func newReconnectBackoff(initial, max time.Duration, factor float64) *reconnectBackoff {
+	if initial <= 0 {
+		initial = DefaultReconnectInterval
+	}
+	if max < initial {
+		max = initial
+	}
+	if factor < 1 {
+		factor = 1
+	}
+	return &reconnectBackoff{
+		initial: initial,
+		max:     max,
+		factor:  factor,
+		jitter:  ReconnectJitter,
+	}
+}
+
+// next returns the delay before the upcoming attempt and advances the backoff.
+func (b *reconnectBackoff) next() time.Duration {
+	if b.current == 0 {
+		b.current = b.initial
+	} else {
+		b.current = time.Duration(float64(b.current) * b.factor)
+		if b.current > b.max {
+			b.current = b.max
+		}
+	}
+
+	delay := b.current
+	if b.jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * b.jitter * float64(delay))
+	}
+	return delay
+}
+
+// reset starts the next backoff sequence from the initial delay.
+func (b *reconnectBackoff) reset() {
+	b.current = 0
+}
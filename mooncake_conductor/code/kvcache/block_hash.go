@@ -0,0 +1,68 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"encoding/hex"
+	"strconv"
+)
+
+// BlockHash identifies a KV cache block.
+//
+// vLLM emits either a 64-bit integer (builtin hash) or, with the sha256 and
+// sha256_cbor hashing modes, an opaque byte string. Both are kept exactly.
+// BlockHash is comparable and can be used directly as a map key; an integer
+// hash never equals a bytes hash.
+type BlockHash struct {
+	value int64
+	raw   string // raw hash bytes; empty for integer hashes
+	isRaw bool
+}
+
+// Int64BlockHash returns a BlockHash holding an integer hash.
+func Int64BlockHash(v int64) BlockHash {
+	return BlockHash{value: v}
+}
+
+// BytesBlockHash returns a BlockHash holding a copy of raw hash bytes.
+func BytesBlockHash(b []byte) BlockHash {
+	return BlockHash{raw: string(b), isRaw: true}
+}
+
+// IsBytes reports whether the hash is a byte string.
+func (h BlockHash) IsBytes() bool {
+	return h.isRaw
+}
+
+// Int64 returns the integer hash and true, or 0 and false for bytes hashes.
+func (h BlockHash) Int64() (int64, bool) {
+	return h.value, !h.isRaw
+}
+
+// Bytes returns the raw hash bytes, or nil for integer hashes.
+func (h BlockHash) Bytes() []byte {
+	if !h.isRaw {
+		return nil
+	}
+	return []byte(h.raw)
+}
+
+// String formats integer hashes in decimal and bytes hashes in hex.
+func (h BlockHash) String() string {
+	if h.isRaw {
+		return hex.EncodeToString([]byte(h.raw))
+	}
+	return strconv.FormatInt(h.value, 10)
+}
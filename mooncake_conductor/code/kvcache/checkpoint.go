@@ -0,0 +1,107 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint records the last batch of a service handed to the event
+// handler, so a restarted client can resume the stream with a replay.
+type Checkpoint struct {
+	Service   string    `json:"service"`
+	Publisher string    `json:"publisher"` // Endpoint the sequence belongs to
+	Seq       int64     `json:"seq"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CheckpointStore keeps one checkpoint per service in
+// <dir>/<service>.checkpoint.json. Files are replaced atomically, so a
+// crash leaves either the previous or the new checkpoint.
+type CheckpointStore struct {
+	dir string
+}
+
+// NewCheckpointStore creates a store in dir, creating dir if needed.
+func NewCheckpointStore(dir string) (*CheckpointStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint dir: %w", err)
+	}
+	return &CheckpointStore{dir: dir}, nil
+}
+
+func (s *CheckpointStore) path(service string) string {
+	return filepath.Join(s.dir, filepath.Base(service)+".checkpoint.json")
+}
+
+// Load returns the checkpoint of a service, or nil if it has none.
+func (s *CheckpointStore) Load(service string) (*Checkpoint, error) {
+	data, err := os.ReadFile(s.path(service))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", s.path(service), err)
+	}
+	return &checkpoint, nil
+}
+
+// Save replaces the checkpoint of checkpoint.Service.
+func (s *CheckpointStore) Save(checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	// Write a temporary file and rename it over the old checkpoint
+	path := s.path(checkpoint.Service)
+	tmp, err := os.CreateTemp(s.dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint: %w", err)
+	}
+
+	// Persist the rename itself
+	if dir, err := os.Open(s.dir); err == nil {
+		_ = dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrHandshakeRejected is returned by a Transport when the publisher
+// rejects the security handshake, e.g. because it does not know the
+// client's CURVE key or the configured server key is wrong.
+var ErrHandshakeRejected = errors.New("publisher rejected the handshake")
+
+// CurveKeys holds the Z85-encoded keys of a CURVE client.
+type CurveKeys struct {
+	ServerKey string // Publisher's long-term public key
+	PublicKey string // Client public key
+	SecretKey string // Client secret key
+}
+
+// LoadCurveKeys reads the publisher's public key and the client key pair.
+//
+// Both files may be ZeroMQ certificates as written by zcert (the client
+// file must be the "_secret" certificate holding both keys). The server
+// key file may also hold just the 40-character Z85 key.
+func LoadCurveKeys(serverKeyFile, clientKeyFile string) (*CurveKeys, error) {
+	server, err := readCurveCert(serverKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CURVE server key: %w", err)
+	}
+	client, err := readCurveCert(clientKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CURVE client keys: %w", err)
+	}
+
+	keys := &CurveKeys{
+		ServerKey: server["public-key"],
+		PublicKey: client["public-key"],
+		SecretKey: client["secret-key"],
+	}
+	if err := keys.Validate(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Validate checks that all keys are present and decode to 32 bytes.
+func (k *CurveKeys) Validate() error {
+	for _, key := range []struct{ name, value string }{
+		{"server public key", k.ServerKey},
+		{"client public key", k.PublicKey},
+		{"client secret key", k.SecretKey},
+	} {
+		if key.value == "" {
+			return fmt.Errorf("CURVE %s is missing", key.name)
+		}
+		if b, err := z85Decode(key.value); err != nil || len(b) != 32 {
+			return fmt.Errorf("CURVE %s is not a 40-character Z85 key", key.name)
+		}
+	}
+	return nil
+}
+
+// readCurveCert returns the keys of a zcert certificate. A file holding
+// only a Z85 key is read as a public key.
+func readCurveCert(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if key := string(bytes.TrimSpace(data)); len(key) == 40 && !strings.ContainsAny(key, " =\n") {
+		return map[string]string{"public-key": key}, nil
+	}
+
+	keys := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if name == "public-key" || name == "secret-key" {
+			keys[name] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no CURVE key found in %s", path)
+	}
+	return keys, nil
+}
+
+// Z85 encoding, see https://rfc.zeromq.org/spec/32/
+const z85Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.-:+=^!/*?&<>()[]{}@%$#"
+
+// z85Decode decodes a Z85 string whose length is a multiple of 5.
+func z85Decode(s string) ([]byte, error) {
+	if len(s)%5 != 0 {
+		return nil, fmt.Errorf("Z85 length %d is not a multiple of 5", len(s))
+	}
+
+	out := make([]byte, 0, len(s)*4/5)
+	for i := 0; i < len(s); i += 5 {
+		var value uint64
+		for j := 0; j < 5; j++ {
+			digit := strings.IndexByte(z85Alphabet, s[i+j])
+			if digit < 0 {
+				return nil, fmt.Errorf("invalid Z85 character %q", s[i+j])
+			}
+			value = value*85 + uint64(digit)
+		}
+		if value > 0xffffffff {
+			return nil, errors.New("invalid Z85 block")
+		}
+		out = append(out, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+	}
+	return out, nil
+}
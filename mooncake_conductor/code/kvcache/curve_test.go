@@ -0,0 +1,208 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// Example key pairs of the CurveZMQ specification, also used by the libzmq
+// test suite
+const (
+	testServerPublic = "rq:rM>}U?@Lns47E1%kR.o@n%FcmmsL/@{H8]yf7"
+	testServerSecret = "JTKVSB%%)wK0E.X)V>+}o?pNmC{O&4W4b!Ni{Lh6"
+	testClientPublic = "Yne@$w-vo<fVvi]a<NY6T1ed:M$fCG*[IaLV{hID"
+	testClientSecret = "D:)Q[IlAW!ahhC2ac:9*A}h:p?([4%wOTJ%JR%cs"
+)
+
+// z85Encode is the inverse of z85Decode, for input whose length is a
+// multiple of 4.
+func z85Encode(b []byte) string {
+	var out strings.Builder
+	for i := 0; i < len(b); i += 4 {
+		value := uint32(b[i])<<24 | uint32(b[i+1])<<16 | uint32(b[i+2])<<8 | uint32(b[i+3])
+		var block [5]byte
+		for j := 4; j >= 0; j-- {
+			block[j] = z85Alphabet[value%85]
+			value /= 85
+		}
+		out.Write(block[:])
+	}
+	return out.String()
+}
+
+func TestZ85Decode(t *testing.T) {
+	cases := []struct {
+		name    string
+		encoded string
+		want    []byte
+		wantErr bool
+	}{
+		// The test vector of RFC 32
+		{name: "HelloWorld", encoded: "HelloWorld", want: []byte{0x86, 0x4F, 0xD2, 0x6F, 0xB5, 0x59, 0xF7, 0x5B}},
+		{name: "empty", encoded: "", want: []byte{}},
+		{name: "zeros", encoded: "00000", want: []byte{0, 0, 0, 0}},
+		{name: "max block", encoded: "%nSc0", want: []byte{0xff, 0xff, 0xff, 0xff}},
+		{name: "block overflows 32 bits", encoded: "#####", wantErr: true},
+		{name: "length not a multiple of 5", encoded: "Hello1", wantErr: true},
+		{name: "character outside the alphabet", encoded: "Hello Worl", wantErr: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := z85Decode(tc.encoded)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("z85Decode(%q) = %x, want an error", tc.encoded, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("z85Decode(%q) failed: %v", tc.encoded, err)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("z85Decode(%q) = %x, want %x", tc.encoded, got, tc.want)
+			}
+			if encoded := z85Encode(got); encoded != tc.encoded {
+				t.Errorf("z85Encode(%x) = %q, want %q", got, encoded, tc.encoded)
+			}
+		})
+	}
+}
+
+// TestZ85DecodeKeyPairs checks the decoded example keys against each
+// other: every public key must derive from its secret key.
+func TestZ85DecodeKeyPairs(t *testing.T) {
+	for _, pair := range [][2]string{
+		{testServerPublic, testServerSecret},
+		{testClientPublic, testClientSecret},
+	} {
+		public, err := z85Decode(pair[0])
+		if err != nil || len(public) != 32 {
+			t.Fatalf("z85Decode(%q) = %x, %v; want 32 bytes", pair[0], public, err)
+		}
+		secret, err := z85Decode(pair[1])
+		if err != nil || len(secret) != 32 {
+			t.Fatalf("z85Decode(%q) = %x, %v; want 32 bytes", pair[1], secret, err)
+		}
+		derived, err := curve25519.X25519(secret, curve25519.Basepoint)
+		if err != nil {
+			t.Fatalf("failed to derive public key: %v", err)
+		}
+		if !bytes.Equal(derived, public) {
+			t.Errorf("public key of %q = %q, want %q", pair[1], z85Encode(derived), pair[0])
+		}
+	}
+}
+
+// zcertFile returns a certificate the way zcert writes it.
+func zcertFile(public, secret string) string {
+	cert := "#   ****  Generated on 2025-01-01 00:00:00 by CZMQ  ****\n" +
+		"#   ZeroMQ CURVE **Secret** Certificate\n" +
+		"#   DO NOT PROVIDE THIS FILE TO OTHER USERS nor change its permissions.\n" +
+		"\n" +
+		"metadata\n" +
+		"    name = \"conductor\"\n" +
+		"curve\n" +
+		"    public-key = \"" + public + "\"\n"
+	if secret != "" {
+		cert += "    secret-key = \"" + secret + "\"\n"
+	}
+	return cert
+}
+
+func writeKeyFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadCurveKeys(t *testing.T) {
+	clientCert := zcertFile(testClientPublic, testClientSecret)
+	cases := []struct {
+		name       string
+		serverFile string
+		clientFile string
+		wantErr    string
+	}{
+		{name: "zcert public certificate", serverFile: zcertFile(testServerPublic, ""), clientFile: clientCert},
+		{name: "bare key", serverFile: testServerPublic + "\n", clientFile: clientCert},
+		{name: "bare key with whitespace", serverFile: "  " + testServerPublic + "\r\n\n", clientFile: clientCert},
+		{
+			// The secret certificate also holds the public key
+			name:       "zcert secret certificate as server key",
+			serverFile: zcertFile(testServerPublic, testServerSecret),
+			clientFile: clientCert,
+		},
+		{
+			name:       "client public certificate",
+			serverFile: testServerPublic,
+			clientFile: zcertFile(testClientPublic, ""),
+			wantErr:    "client secret key is missing",
+		},
+		{
+			name:       "bare client key",
+			serverFile: testServerPublic,
+			clientFile: testClientPublic,
+			wantErr:    "client secret key is missing",
+		},
+		{
+			name:       "truncated key",
+			serverFile: zcertFile(testServerPublic[:35], ""),
+			clientFile: clientCert,
+			wantErr:    "server public key is not a 40-character Z85 key",
+		},
+		{
+			name:       "no key",
+			serverFile: "# empty certificate\ncurve\n",
+			clientFile: clientCert,
+			wantErr:    "no CURVE key found",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			keys, err := LoadCurveKeys(
+				writeKeyFile(t, "server.key", tc.serverFile),
+				writeKeyFile(t, "client.key_secret", tc.clientFile))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("LoadCurveKeys = %+v, %v; want error %q", keys, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadCurveKeys failed: %v", err)
+			}
+			want := CurveKeys{ServerKey: testServerPublic, PublicKey: testClientPublic, SecretKey: testClientSecret}
+			if *keys != want {
+				t.Errorf("LoadCurveKeys = %+v, want %+v", *keys, want)
+			}
+		})
+	}
+
+	if _, err := LoadCurveKeys(filepath.Join(t.TempDir(), "missing"), ""); err == nil {
+		t.Error("LoadCurveKeys succeeded without a server key file")
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a received message whose payload could not be decoded.
+type DeadLetter struct {
+	Service    string    `json:"service"`
+	Topic      []byte    `json:"topic"`
+	Seq        int64     `json:"seq"`
+	Payload    []byte    `json:"payload"`
+	Error      string    `json:"error"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// DeadLetterStore quarantines undecodable messages so a subscription can keep
+// running. The most recent messages are kept in a bounded ring; if a spill
+// directory is set, every message is also appended to
+// <dir>/<service>.deadletter.jsonl so it outlives the ring. A spill file is
+// rotated to .1 once it reaches DefaultDeadLetterSpillBytes, and messages
+// recovered by Redecode are removed from it.
+type DeadLetterStore struct {
+	redecodeMu sync.Mutex
+
+	mu         sync.Mutex
+	ring       []DeadLetter
+	next       int // ring index of the next write
+	size       int
+	counts     map[string]uint64
+	spillDir   string
+	spillLimit int64
+}
+
+// NewDeadLetterStore creates a store holding up to capacity messages.
+// An empty spillDir disables spilling to disk.
+func NewDeadLetterStore(capacity int, spillDir string) (*DeadLetterStore, error) {
+	if capacity <= 0 {
+		capacity = DefaultDeadLetterCapacity
+	}
+	if spillDir != "" {
+		if err := os.MkdirAll(spillDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create dead letter dir: %w", err)
+		}
+	}
+	return &DeadLetterStore{
+		ring:       make([]DeadLetter, capacity),
+		counts:     make(map[string]uint64),
+		spillDir:   spillDir,
+		spillLimit: DefaultDeadLetterSpillBytes,
+	}, nil
+}
+
+// Add quarantines a message, evicting the oldest one when the ring is full.
+func (s *DeadLetterStore) Add(letter DeadLetter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ring[s.next] = letter
+	s.next = (s.next + 1) % len(s.ring)
+	if s.size < len(s.ring) {
+		s.size++
+	}
+	s.counts[letter.Service]++
+
+	if s.spillDir != "" {
+		if err := s.spill(letter); err != nil {
+			// The message is still in the ring; spilling is best effort
+			slog.Error("Failed to spill dead letter", "service", letter.Service, "error", err)
+		}
+	}
+}
+
+func (s *DeadLetterStore) spillPath(service string) string {
+	return filepath.Join(s.spillDir, filepath.Base(service)+".deadletter.jsonl")
+}
+
+func (s *DeadLetterStore) spill(letter DeadLetter) error {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	path := s.spillPath(letter.Service)
+	if info, err := os.Stat(path); err == nil && info.Size()+int64(len(line)) > s.spillLimit {
+		// Keep one rotated file, dropping the one before it
+		if err := os.Rename(path, path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate spill file: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(line)
+	return err
+}
+
+// spillKey identifies a quarantined message across the ring and spill files.
+type spillKey struct {
+	seq        int64
+	receivedAt int64
+}
+
+func keyOf(letter DeadLetter) spillKey {
+	return spillKey{seq: letter.Seq, receivedAt: letter.ReceivedAt.UnixNano()}
+}
+
+// readSpillFile returns the messages in one spill file, oldest first.
+func readSpillFile(file string) ([]DeadLetter, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var letters []DeadLetter
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var letter DeadLetter
+		if err := dec.Decode(&letter); err == io.EOF {
+			return letters, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		letters = append(letters, letter)
+	}
+}
+
+// unspill rewrites the spill files of a service without the given messages.
+func (s *DeadLetterStore) unspill(service string, drop map[spillKey]bool) error {
+	path := s.spillPath(service)
+	for _, file := range []string{path + ".1", path} {
+		letters, err := readSpillFile(file)
+		if err != nil {
+			return err
+		}
+		if letters == nil {
+			continue
+		}
+
+		var kept bytes.Buffer
+		enc := json.NewEncoder(&kept)
+		for _, letter := range letters {
+			if drop[keyOf(letter)] {
+				continue
+			}
+			if err := enc.Encode(letter); err != nil {
+				return err
+			}
+		}
+
+		tmp := file + ".tmp"
+		if err := os.WriteFile(tmp, kept.Bytes(), 0o644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the quarantined messages of a service, oldest first.
+// An empty service lists all messages.
+func (s *DeadLetterStore) List(service string) []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]DeadLetter, 0, s.size)
+	start := (s.next - s.size + len(s.ring)) % len(s.ring)
+	for i := 0; i < s.size; i++ {
+		letter := s.ring[(start+i)%len(s.ring)]
+		if service == "" || letter.Service == service {
+			result = append(result, letter)
+		}
+	}
+	return result
+}
+
+// Count returns how many messages of a service were ever quarantined,
+// including those since evicted from the ring.
+func (s *DeadLetterStore) Count(service string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[service]
+}
+
+// Counts returns the quarantine counter of every service.
+func (s *DeadLetterStore) Counts() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string]uint64, len(s.counts))
+	for service, n := range s.counts {
+		result[service] = n
+	}
+	return result
+}
+
+// Redecode retries the quarantined messages of a service with decoder and
+// passes every decoded batch to apply in the original order. Messages only
+// left in the spill files are retried as well. Messages that decode are
+// removed from the ring and the spill files; the others stay quarantined.
+func (s *DeadLetterStore) Redecode(service string, decoder Decoder, apply func(letter DeadLetter, batch *EventBatch)) (int, error) {
+	// One Redecode at a time, so no message is recovered twice
+	s.redecodeMu.Lock()
+	defer s.redecodeMu.Unlock()
+
+	letters := s.quarantined(service)
+
+	// Decode outside the lock so slow decoders do not block Add
+	type recoveredLetter struct {
+		letter DeadLetter
+		batch  *EventBatch
+	}
+	var (
+		recovered []recoveredLetter
+		failures  = make(map[spillKey]string)
+		lastErr   error
+	)
+	for _, letter := range letters {
+		batch, err := decoder.Decode(letter.Payload)
+		if err != nil {
+			failures[keyOf(letter)] = err.Error()
+			lastErr = err
+			continue
+		}
+		recovered = append(recovered, recoveredLetter{letter: letter, batch: batch})
+	}
+
+	drop := make(map[spillKey]bool, len(recovered))
+	for _, r := range recovered {
+		drop[keyOf(r.letter)] = true
+	}
+
+	s.mu.Lock()
+	kept := make([]DeadLetter, 0, s.size)
+	start := (s.next - s.size + len(s.ring)) % len(s.ring)
+	for i := 0; i < s.size; i++ {
+		letter := s.ring[(start+i)%len(s.ring)]
+		if letter.Service == service {
+			if drop[keyOf(letter)] {
+				continue
+			}
+			if msg, ok := failures[keyOf(letter)]; ok {
+				letter.Error = msg
+			}
+		}
+		kept = append(kept, letter)
+	}
+
+	// Compact the ring
+	for i := range s.ring {
+		s.ring[i] = DeadLetter{}
+	}
+	copy(s.ring, kept)
+	s.size = len(kept)
+	s.next = len(kept) % len(s.ring)
+
+	if s.spillDir != "" && len(recovered) > 0 {
+		if err := s.unspill(service, drop); err != nil {
+			slog.Error("Failed to remove recovered dead letters from spill file", "service", service, "error", err)
+		}
+	}
+	s.mu.Unlock()
+
+	// Apply outside the lock so slow handlers do not block Add
+	for _, r := range recovered {
+		apply(r.letter, r.batch)
+	}
+
+	if lastErr != nil {
+		return len(recovered), fmt.Errorf("%d message(s) still fail to decode, last error: %w", len(failures), lastErr)
+	}
+	return len(recovered), nil
+}
+
+// quarantined returns the messages of a service in the spill files and the
+// ring, oldest first. The spill files also hold messages evicted from the
+// ring.
+func (s *DeadLetterStore) quarantined(service string) []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var letters []DeadLetter
+	seen := make(map[spillKey]bool)
+	if s.spillDir != "" {
+		path := s.spillPath(service)
+		for _, file := range []string{path + ".1", path} {
+			spilled, err := readSpillFile(file)
+			if err != nil {
+				// The ring still holds the latest messages
+				slog.Error("Failed to read dead letter spill file", "service", service, "error", err)
+				continue
+			}
+			for _, letter := range spilled {
+				if letter.Service == service && !seen[keyOf(letter)] {
+					seen[keyOf(letter)] = true
+					letters = append(letters, letter)
+				}
+			}
+		}
+	}
+
+	start := (s.next - s.size + len(s.ring)) % len(s.ring)
+	for i := 0; i < s.size; i++ {
+		letter := s.ring[(start+i)%len(s.ring)]
+		if letter.Service == service && !seen[keyOf(letter)] {
+			seen[keyOf(letter)] = true
+			letters = append(letters, letter)
+		}
+	}
+	slices.SortStableFunc(letters, func(a, b DeadLetter) int {
+		return a.ReceivedAt.Compare(b.ReceivedAt)
+	})
+	return letters
+}
@@ -0,0 +1,302 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readSpill returns the sequence numbers in a spill file.
+func readSpill(t *testing.T, path string) []int64 {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("failed to read spill file: %v", err)
+	}
+
+	var seqs []int64
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var letter DeadLetter
+		if err := dec.Decode(&letter); err == io.EOF {
+			return seqs
+		} else if err != nil {
+			t.Fatalf("failed to parse spill file: %v", err)
+		}
+		seqs = append(seqs, letter.Seq)
+	}
+}
+
+func TestDeadLetterSpillRotation(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDeadLetterStore(4, dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	store.spillLimit = 600
+
+	for seq := int64(0); seq < 10; seq++ {
+		store.Add(DeadLetter{Service: "svc", Seq: seq, Payload: bytes.Repeat([]byte{'x'}, 64), ReceivedAt: time.Now()})
+	}
+
+	path := filepath.Join(dir, "svc.deadletter.jsonl")
+	for _, file := range []string{path, path + ".1"} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("missing spill file: %v", err)
+		}
+		if info.Size() > store.spillLimit {
+			t.Errorf("%s is %d bytes, limit %d", file, info.Size(), store.spillLimit)
+		}
+	}
+	current, rotated := readSpill(t, path), readSpill(t, path+".1")
+	if len(current) == 0 || current[len(current)-1] != 9 {
+		t.Errorf("current spill = %v, want it to end with 9", current)
+	}
+	if len(rotated) == 0 || rotated[len(rotated)-1]+1 != current[0] {
+		t.Errorf("rotated spill = %v does not precede %v", rotated, current)
+	}
+}
+
+func TestDeadLetterRedecodeTrimsSpill(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDeadLetterStore(8, dir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	good, err := EncodeEventBatch(&EventBatch{Timestamp: time.Now()})
+	if err != nil {
+		t.Fatalf("failed to encode batch: %v", err)
+	}
+	store.Add(DeadLetter{Service: "svc", Seq: 1, Payload: good, ReceivedAt: time.Now()})
+	store.Add(DeadLetter{Service: "svc", Seq: 2, Payload: []byte{0xc1}, ReceivedAt: time.Now()})
+	store.Add(DeadLetter{Service: "other", Seq: 1, Payload: good, ReceivedAt: time.Now()})
+
+	decoder, err := NewDecoder(ServiceTypeVLLM, DefaultZMQClientConfig("svc", "127.0.0.1", ""))
+	if err != nil {
+		t.Fatalf("failed to create decoder: %v", err)
+	}
+	var applied []int64
+	n, err := store.Redecode("svc", decoder, func(letter DeadLetter, batch *EventBatch) {
+		applied = append(applied, letter.Seq)
+		batch.Release()
+	})
+	if n != 1 || err == nil {
+		t.Fatalf("Redecode = %d, %v; want 1 and an error for seq 2", n, err)
+	}
+	if len(applied) != 1 || applied[0] != 1 {
+		t.Errorf("applied %v, want [1]", applied)
+	}
+
+	if got := readSpill(t, filepath.Join(dir, "svc.deadletter.jsonl")); len(got) != 1 || got[0] != 2 {
+		t.Errorf("svc spill = %v, want [2]", got)
+	}
+	if got := readSpill(t, filepath.Join(dir, "other.deadletter.jsonl")); len(got) != 1 {
+		t.Errorf("other spill = %v, want it untouched", got)
+	}
+	if got := store.List("svc"); len(got) != 1 || got[0].Seq != 2 {
+		t.Errorf("ring = %v, want only seq 2", got)
+	}
+}
+
+// TestDeadLetterRedecodeSpilled checks that messages evicted from the ring
+// are still recovered from the spill files.
+func TestDeadLetterRedecodeSpilled(t *testing.T) {
+	store, err := NewDeadLetterStore(2, t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	good, err := EncodeEventBatch(&EventBatch{Timestamp: time.Now()})
+	if err != nil {
+		t.Fatalf("failed to encode batch: %v", err)
+	}
+	for seq := int64(0); seq < 5; seq++ {
+		store.Add(DeadLetter{Service: "svc", Seq: seq, Payload: good, ReceivedAt: time.Now()})
+	}
+
+	decoder, err := NewDecoder(ServiceTypeVLLM, DefaultZMQClientConfig("svc", "127.0.0.1", ""))
+	if err != nil {
+		t.Fatalf("failed to create decoder: %v", err)
+	}
+	var applied []int64
+	n, err := store.Redecode("svc", decoder, func(letter DeadLetter, batch *EventBatch) {
+		applied = append(applied, letter.Seq)
+		batch.Release()
+	})
+	if n != 5 || err != nil {
+		t.Fatalf("Redecode = %d, %v; want 5, nil", n, err)
+	}
+	for i, seq := range applied {
+		if seq != int64(i) {
+			t.Fatalf("applied %v, want 0 to 4 in order", applied)
+		}
+	}
+	if got := store.List("svc"); len(got) != 0 {
+		t.Errorf("ring still holds %d messages", len(got))
+	}
+}
+
+// flakyDecoder fails while broken is set, like a decoder awaiting a fix.
+type flakyDecoder struct {
+	broken atomic.Bool
+}
+
+func (d *flakyDecoder) Decode(payload []byte) (*EventBatch, error) {
+	if d.broken.Load() {
+		return nil, errors.New("unsupported payload")
+	}
+	return DecodeEventBatch(payload)
+}
+
+// TestRedecodeOnlyLatestBatch checks that a recovered batch is only applied
+// while no later batch was handled, since it could otherwise bring back
+// blocks removed in the meantime.
+func TestRedecodeOnlyLatestBatch(t *testing.T) {
+	payload, err := EncodeEventBatch(&EventBatch{
+		Timestamp: time.Now(),
+		Events:    []KVEvent{&AllBlocksClearedEvent{Type: EventTypeAllCleared}},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode batch: %v", err)
+	}
+
+	for _, later := range []bool{false, true} {
+		t.Run(fmt.Sprintf("later=%v", later), func(t *testing.T) {
+			config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+			config.RouterPort = 0
+			store, err := NewDeadLetterStore(8, "")
+			if err != nil {
+				t.Fatalf("failed to create store: %v", err)
+			}
+			decoder := &flakyDecoder{}
+			decoder.broken.Store(true)
+
+			transport := NewMemoryTransport(16, 16)
+			recorder := &eventRecorder{}
+			client := NewStaticZMQClient(config, recorder, decoder)
+			client.SetTransport(transport)
+			client.SetDeadLetterStore(store)
+			if err := client.Start(); err != nil {
+				t.Fatalf("failed to start client: %v", err)
+			}
+			defer client.Stop()
+
+			waitUntil(t, "the client connects", transport.Connected)
+			transport.Publish(nil, 0, payload)
+			waitUntil(t, "seq 0 is quarantined", func() bool { return len(store.List("svc")) == 1 })
+			decoder.broken.Store(false)
+			want := 1
+			if later {
+				transport.Publish(nil, 1, payload)
+				waitUntil(t, "seq 1 is handled", func() bool { return recorder.count() == 1 })
+			}
+
+			if n, err := client.RedecodeDeadLetters(); n != 1 || err != nil {
+				t.Fatalf("RedecodeDeadLetters = %d, %v; want 1, nil", n, err)
+			}
+			if !later {
+				waitUntil(t, "seq 0 is applied", func() bool { return recorder.count() == want })
+				return
+			}
+			waitUntil(t, "seq 0 is quarantined again", func() bool { return len(store.List("svc")) == 1 })
+			if letter := store.List("svc")[0]; letter.Seq != 0 || letter.Error != errRecoveredOutOfOrder.Error() {
+				t.Errorf("dead letter seq %d, error %q", letter.Seq, letter.Error)
+			}
+			if got := recorder.count(); got != want {
+				t.Errorf("handled %d events, want %d", got, want)
+			}
+		})
+	}
+}
+
+// TestMalformedMessageQuarantined checks that bad frames are dead-lettered
+// and the stream carries on with the next message.
+func TestMalformedMessageQuarantined(t *testing.T) {
+	config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+	config.RouterPort = 0
+	decoder, err := NewDecoder(ServiceTypeVLLM, config)
+	if err != nil {
+		t.Fatalf("failed to create decoder: %v", err)
+	}
+	store, err := NewDeadLetterStore(8, "")
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	transport := NewMemoryTransport(16, 16)
+	recorder := &eventRecorder{}
+	client := NewStaticZMQClient(config, recorder, decoder)
+	client.SetTransport(transport)
+	client.SetDeadLetterStore(store)
+	if err := client.Start(); err != nil {
+		t.Fatalf("failed to start client: %v", err)
+	}
+	defer client.Stop()
+
+	payload, err := EncodeEventBatch(&EventBatch{
+		Timestamp: time.Now(),
+		Events:    []KVEvent{&AllBlocksClearedEvent{Type: EventTypeAllCleared}},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode batch: %v", err)
+	}
+	waitUntil(t, "the client connects", transport.Connected)
+	transport.SendRaw([]byte("topic"), payload)
+	transport.SendRaw([]byte("topic"), []byte{0, 1}, payload)
+	transport.Publish(nil, 0, payload)
+
+	waitUntil(t, "the valid batch is handled", func() bool { return recorder.count() == 1 })
+	letters := store.List("svc")
+	if len(letters) != 2 {
+		t.Fatalf("quarantined %d messages, want 2", len(letters))
+	}
+	for _, letter := range letters {
+		if letter.Seq != -1 || !bytes.Equal(letter.Payload, payload) {
+			t.Errorf("unexpected dead letter: seq %d, %d payload bytes", letter.Seq, len(letter.Payload))
+		}
+	}
+	if transport.Connects() != 1 {
+		t.Errorf("client reconnected %d times", transport.Connects()-1)
+	}
+}
+
+func TestSkipDepthLimit(t *testing.T) {
+	nested := append(bytes.Repeat([]byte{0x91}, maxSkipDepth+1), 0x00)
+	r := getReader(nested)
+	defer putReader(r)
+	if err := r.skip(); err == nil {
+		t.Fatal("expected an error for nesting past maxSkipDepth")
+	}
+
+	shallow := append(bytes.Repeat([]byte{0x91}, maxSkipDepth-1), 0x00)
+	r2 := getReader(shallow)
+	defer putReader(r2)
+	if err := r2.skip(); err != nil {
+		t.Fatalf("unexpected error for %d levels: %v", maxSkipDepth-1, err)
+	}
+}
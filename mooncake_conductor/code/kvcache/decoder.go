@@ -0,0 +1,93 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ServiceType defines the type of engine publishing KV events
+type ServiceType string
+
+const (
+	ServiceTypeVLLM     ServiceType = "vLLM"
+	ServiceTypeMooncake ServiceType = "Mooncake"
+	ServiceTypeSGLang   ServiceType = "SGLang"
+)
+
+// Decoder turns the payload frame of a published message into a batch of KV events.
+type Decoder interface {
+	Decode(payload []byte) (*EventBatch, error)
+}
+
+// DecoderFunc adapts an ordinary function to the Decoder interface.
+type DecoderFunc func(payload []byte) (*EventBatch, error)
+
+// Decode calls f(payload).
+func (f DecoderFunc) Decode(payload []byte) (*EventBatch, error) {
+	return f(payload)
+}
+
+// DecoderFactory builds a Decoder for one client configuration.
+type DecoderFactory func(config *ZMQClientConfig) (Decoder, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[ServiceType]DecoderFactory{}
+)
+
+func init() {
+	RegisterDecoder(ServiceTypeVLLM, newVLLMDecoder)
+	RegisterDecoder(ServiceTypeSGLang, newVLLMDecoder)
+}
+
+// RegisterDecoder adds or replaces the decoder factory for a service type.
+func RegisterDecoder(serviceType ServiceType, factory DecoderFactory) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[serviceType] = factory
+}
+
+// NewDecoder builds the decoder registered for a service type.
+// An empty service type selects vLLM.
+func NewDecoder(serviceType ServiceType, config *ZMQClientConfig) (Decoder, error) {
+	if serviceType == "" {
+		serviceType = ServiceTypeVLLM
+	}
+
+	decodersMu.RLock()
+	factory, ok := decoders[serviceType]
+	decodersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no decoder registered for service type %q", serviceType)
+	}
+	return factory(config)
+}
+
+// newVLLMDecoder resolves the configured wire format once per client.
+//
+// SGLang services use it as is: SGLang's publisher is a port of vLLM's and
+// sends the same msgspec batches, with attn_dp_rank in the position of
+// data_parallel_rank. No SGLang-specific field mapping is applied.
+func newVLLMDecoder(config *ZMQClientConfig) (Decoder, error) {
+	format, err := LookupWireFormat(config.WireFormat)
+	if err != nil {
+		return nil, err
+	}
+	return DecoderFunc(func(payload []byte) (*EventBatch, error) {
+		return decodeEventBatch(payload, format)
+	}), nil
+}
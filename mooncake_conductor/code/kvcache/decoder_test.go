@@ -0,0 +1,61 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewDecoder(t *testing.T) {
+	rank := 2
+	payload, err := EncodeEventBatch(&EventBatch{
+		Timestamp:        time.Unix(1700000000, 0),
+		DataParallelRank: &rank,
+		Events: []KVEvent{&BlockRemovedEvent{
+			Type:        EventTypeBlockRemoved,
+			BlockHashes: []BlockHash{Int64BlockHash(-7)},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode batch: %v", err)
+	}
+
+	// SGLang shares the vLLM decoder; its attn_dp_rank is the third field
+	for _, serviceType := range []ServiceType{"", ServiceTypeVLLM, ServiceTypeSGLang} {
+		decoder, err := NewDecoder(serviceType, &ZMQClientConfig{})
+		if err != nil {
+			t.Fatalf("%q: failed to create decoder: %v", serviceType, err)
+		}
+		batch, err := decoder.Decode(payload)
+		if err != nil {
+			t.Fatalf("%q: failed to decode: %v", serviceType, err)
+		}
+		if batch.DataParallelRank == nil || *batch.DataParallelRank != rank {
+			t.Errorf("%q: rank = %v, want %d", serviceType, batch.DataParallelRank, rank)
+		}
+		if len(batch.Events) != 1 || batch.Events[0].GetType() != EventTypeBlockRemoved {
+			t.Errorf("%q: unexpected events %v", serviceType, batch.Events)
+		}
+		batch.Release()
+	}
+
+	if _, err := NewDecoder("unknown", &ZMQClientConfig{}); err == nil {
+		t.Error("expected an error for an unregistered service type")
+	}
+	if _, err := NewDecoder(ServiceTypeSGLang, &ZMQClientConfig{WireFormat: "sglang"}); err == nil {
+		t.Error("expected an error for an unknown wire format")
+	}
+}
@@ -18,8 +18,133 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 )
 
+// Endpoint schemes accepted in PubEndpoint and ReplayEndpoint
+const (
+	EndpointTCP    = "tcp"    // tcp://host:port, host being an IP or a hostname
+	EndpointIPC    = "ipc"    // ipc:///path/to/socket, or ipc://@name for an abstract socket
+	EndpointInproc = "inproc" // inproc://name, a publisher in the same process (zmq tag only)
+)
+
+// maxIPCPathLength is the size of sun_path minus its terminating NUL
+const maxIPCPathLength = 107
+
+// Endpoint is a parsed publisher endpoint URL.
+type Endpoint struct {
+	Scheme string
+	Host   string // tcp only
+	Port   int    // tcp only
+	Path   string // ipc socket path or inproc name
+}
+
+// ParseEndpoint parses and validates a ZMQ endpoint URL the client can
+// connect to. Bind-only forms such as wildcard hosts are rejected.
+func ParseEndpoint(raw string) (*Endpoint, error) {
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok {
+		return nil, fmt.Errorf("invalid endpoint %q: missing scheme", raw)
+	}
+
+	switch scheme {
+	case EndpointTCP:
+		host, portStr, err := net.SplitHostPort(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint %q: %w", raw, err)
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid endpoint %q: invalid port %q", raw, portStr)
+		}
+		if err := validateHost(host); err != nil {
+			return nil, fmt.Errorf("invalid endpoint %q: %w", raw, err)
+		}
+		return &Endpoint{Scheme: scheme, Host: host, Port: port}, nil
+
+	case EndpointIPC:
+		switch {
+		case rest == "" || rest == "@":
+			return nil, fmt.Errorf("invalid endpoint %q: empty socket path", raw)
+		case rest == "*":
+			return nil, fmt.Errorf("invalid endpoint %q: wildcard paths can only be bound", raw)
+		case len(rest) > maxIPCPathLength:
+			return nil, fmt.Errorf("invalid endpoint %q: socket path longer than %d bytes", raw, maxIPCPathLength)
+		}
+		return &Endpoint{Scheme: scheme, Path: rest}, nil
+
+	case EndpointInproc:
+		if rest == "" {
+			return nil, fmt.Errorf("invalid endpoint %q: empty name", raw)
+		}
+		return &Endpoint{Scheme: scheme, Path: rest}, nil
+	}
+	return nil, fmt.Errorf("invalid endpoint %q: unsupported scheme %q", raw, scheme)
+}
+
+// String formats the endpoint as a URL.
+func (e *Endpoint) String() string {
+	if e.Scheme == EndpointTCP {
+		return formatZMQTCPEndpoint(e.Host, e.Port)
+	}
+	return e.Scheme + "://" + e.Path
+}
+
+// IsHostname reports whether the endpoint names its host rather than
+// giving its IP, so the host has to be resolved.
+func (e *Endpoint) IsHostname() bool {
+	return e.Scheme == EndpointTCP && net.ParseIP(e.Host) == nil
+}
+
+// OffsetEndpoint returns the endpoint of data parallel rank rank, following
+// vLLM: tcp ports are offset by the rank and inproc names get a "_dp<rank>"
+// suffix. ipc endpoints cannot be offset.
+func OffsetEndpoint(raw string, rank int) (string, error) {
+	endpoint, err := ParseEndpoint(raw)
+	if err != nil {
+		return "", err
+	}
+
+	switch endpoint.Scheme {
+	case EndpointTCP:
+		endpoint.Port += rank
+		if endpoint.Port > 65535 {
+			return "", fmt.Errorf("endpoint %q has no port for rank %d", raw, rank)
+		}
+	case EndpointInproc:
+		endpoint.Path = fmt.Sprintf("%s_dp%d", endpoint.Path, rank)
+	default:
+		return "", fmt.Errorf("endpoint %q cannot be offset by data parallel rank", raw)
+	}
+	return endpoint.String(), nil
+}
+
+// validateHost accepts an IP address or an RFC 1123 hostname.
+func validateHost(host string) error {
+	if host == "" {
+		return fmt.Errorf("host is required")
+	}
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+
+	name := strings.TrimSuffix(host, ".")
+	if len(name) == 0 || len(name) > 253 {
+		return fmt.Errorf("invalid host: %s", host)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid host: %s", host)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return fmt.Errorf("invalid host: %s", host)
+			}
+		}
+	}
+	return nil
+}
+
 // formatZMQTCPEndpoint creates a properly formatted ZMQ TCP endpoint
 // that correctly handles both IPv4 and IPv6 addresses.
 //
@@ -0,0 +1,120 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	cases := []struct {
+		raw          string
+		want         Endpoint
+		wantHostname bool
+		wantErr      string
+	}{
+		// tcp
+		{raw: "tcp://10.0.0.1:5557", want: Endpoint{Scheme: "tcp", Host: "10.0.0.1", Port: 5557}},
+		{raw: "tcp://[2001:db8::1]:5557", want: Endpoint{Scheme: "tcp", Host: "2001:db8::1", Port: 5557}},
+		{raw: "tcp://[::1]:1", want: Endpoint{Scheme: "tcp", Host: "::1", Port: 1}},
+		{raw: "tcp://vllm-0.vllm.default.svc:5557", want: Endpoint{Scheme: "tcp", Host: "vllm-0.vllm.default.svc", Port: 5557}, wantHostname: true},
+		{raw: "tcp://publisher.:65535", want: Endpoint{Scheme: "tcp", Host: "publisher.", Port: 65535}, wantHostname: true},
+		{raw: "tcp://2001:db8::1:5557", wantErr: "too many colons"},
+		{raw: "tcp://10.0.0.1", wantErr: "missing port"},
+		{raw: "tcp://10.0.0.1:0", wantErr: "invalid port"},
+		{raw: "tcp://10.0.0.1:65536", wantErr: "invalid port"},
+		{raw: "tcp://10.0.0.1:*", wantErr: "invalid port"},
+		{raw: "tcp://:5557", wantErr: "host is required"},
+		{raw: "tcp://*:5557", wantErr: "invalid host"},
+		{raw: "tcp://-publisher:5557", wantErr: "invalid host"},
+		{raw: "tcp://publisher..svc:5557", wantErr: "invalid host"},
+		{raw: "tcp://pub_lisher:5557", wantErr: "invalid host"},
+		{raw: "tcp://" + strings.Repeat("a", 64) + ":5557", wantErr: "invalid host"},
+
+		// ipc
+		{raw: "ipc:///tmp/kv-events.sock", want: Endpoint{Scheme: "ipc", Path: "/tmp/kv-events.sock"}},
+		{raw: "ipc://@kv-events", want: Endpoint{Scheme: "ipc", Path: "@kv-events"}},
+		{raw: "ipc://" + strings.Repeat("a", maxIPCPathLength), want: Endpoint{Scheme: "ipc", Path: strings.Repeat("a", maxIPCPathLength)}},
+		{raw: "ipc://" + strings.Repeat("a", maxIPCPathLength+1), wantErr: "socket path longer than"},
+		{raw: "ipc://", wantErr: "empty socket path"},
+		{raw: "ipc://@", wantErr: "empty socket path"},
+		{raw: "ipc://*", wantErr: "wildcard paths can only be bound"},
+
+		// inproc
+		{raw: "inproc://kv-events", want: Endpoint{Scheme: "inproc", Path: "kv-events"}},
+		{raw: "inproc://", wantErr: "empty name"},
+
+		// Other
+		{raw: "10.0.0.1:5557", wantErr: "missing scheme"},
+		{raw: "udp://10.0.0.1:5557", wantErr: "unsupported scheme"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.raw, func(t *testing.T) {
+			endpoint, err := ParseEndpoint(tc.raw)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("ParseEndpoint = %+v, %v; want error %q", endpoint, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEndpoint failed: %v", err)
+			}
+			if *endpoint != tc.want {
+				t.Errorf("ParseEndpoint = %+v, want %+v", *endpoint, tc.want)
+			}
+			if endpoint.IsHostname() != tc.wantHostname {
+				t.Errorf("IsHostname = %v, want %v", endpoint.IsHostname(), tc.wantHostname)
+			}
+			if s := endpoint.String(); s != tc.raw {
+				t.Errorf("String = %q, want %q", s, tc.raw)
+			}
+		})
+	}
+}
+
+func TestOffsetEndpoint(t *testing.T) {
+	cases := []struct {
+		raw     string
+		rank    int
+		want    string
+		wantErr string
+	}{
+		{raw: "tcp://10.0.0.1:5557", rank: 0, want: "tcp://10.0.0.1:5557"},
+		{raw: "tcp://10.0.0.1:5557", rank: 3, want: "tcp://10.0.0.1:5560"},
+		{raw: "tcp://[2001:db8::1]:5557", rank: 1, want: "tcp://[2001:db8::1]:5558"},
+		{raw: "tcp://publisher.svc:5557", rank: 2, want: "tcp://publisher.svc:5559"},
+		{raw: "tcp://10.0.0.1:65535", rank: 1, wantErr: "has no port for rank 1"},
+		{raw: "inproc://kv-events", rank: 0, want: "inproc://kv-events_dp0"},
+		{raw: "inproc://kv-events", rank: 2, want: "inproc://kv-events_dp2"},
+		{raw: "ipc:///tmp/kv-events.sock", rank: 1, wantErr: "cannot be offset"},
+		{raw: "tcp://10.0.0.1", rank: 1, wantErr: "missing port"},
+	}
+
+	for _, tc := range cases {
+		got, err := OffsetEndpoint(tc.raw, tc.rank)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("OffsetEndpoint(%q, %d) = %q, %v; want error %q", tc.raw, tc.rank, got, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("OffsetEndpoint(%q, %d) = %q, %v; want %q", tc.raw, tc.rank, got, err, tc.want)
+		}
+	}
+}
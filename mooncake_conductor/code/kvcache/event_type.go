@@ -36,6 +36,14 @@ const (
 	EventTypeAllCleared EventType = "AllBlocksCleared"
 )
 
+// Storage tiers reported in the Medium field of events
+const (
+	MediumGPU            = "GPU"
+	MediumCPU            = "CPU"
+	MediumMooncakeMemory = "MOONCAKE_MEMORY"
+	MediumMooncakeDisk   = "MOONCAKE_DISK"
+)
+
 // KVEvent is the base interface for all KV cache events
 type KVEvent interface {
 	GetType() EventType
@@ -44,13 +52,19 @@ type KVEvent interface {
 
 // BlockStoredEvent represents blocks being stored in KV cache
 type BlockStoredEvent struct {
-	Type            EventType `msgpack:"type"`
-	Timestamp       time.Time `msgpack:"timestamp"`
-	BlockHashes     []int64   `msgpack:"block_hashes"`
-	TokenIDs        [][]int32 `msgpack:"token_ids"`                   // One array per block
-	ParentBlockHash *int64    `msgpack:"parent_block_hash,omitempty"` // Parent hash for chaining
-	ModelName       string    `msgpack:"model_name"`
-	PodName         string    `msgpack:"-"` // Set by subscriber
+	Type            EventType   `msgpack:"type"`
+	Timestamp       time.Time   `msgpack:"timestamp"`
+	BlockHashes     []BlockHash `msgpack:"block_hashes"`
+	TokenIDs        [][]int32   `msgpack:"token_ids"`                   // One array per block
+	ParentBlockHash *BlockHash  `msgpack:"parent_block_hash,omitempty"` // Parent hash for chaining
+	BlockSize       int         `msgpack:"block_size,omitempty"`
+	LoraID          *int64      `msgpack:"lora_id,omitempty"`
+	LoraName        string      `msgpack:"lora_name,omitempty"`
+	Medium          string      `msgpack:"medium,omitempty"` // Storage tier, see Medium constants
+	ModelName       string      `msgpack:"model_name"`
+	PodName         string      `msgpack:"-"` // Set by subscriber
+	DPRank          int         `msgpack:"-"` // Data parallel rank, set by subscriber
+	Topic           string      `msgpack:"-"` // Publisher topic, set by subscriber ("" if replayed)
 }
 
 // GetType returns the event type
@@ -65,11 +79,14 @@ func (e *BlockStoredEvent) GetTimestamp() time.Time {
 
 // BlockRemovedEvent represents blocks being removed from KV cache
 type BlockRemovedEvent struct {
-	Type        EventType `msgpack:"type"`
-	Timestamp   time.Time `msgpack:"timestamp"`
-	BlockHashes []int64   `msgpack:"block_hashes"`
-	ModelName   string    `msgpack:"model_name"`
-	PodName     string    `msgpack:"-"` // Set by subscriber
+	Type        EventType   `msgpack:"type"`
+	Timestamp   time.Time   `msgpack:"timestamp"`
+	BlockHashes []BlockHash `msgpack:"block_hashes"`
+	Medium      string      `msgpack:"medium,omitempty"` // Storage tier, see Medium constants
+	ModelName   string      `msgpack:"model_name"`
+	PodName     string      `msgpack:"-"` // Set by subscriber
+	DPRank      int         `msgpack:"-"` // Data parallel rank, set by subscriber
+	Topic       string      `msgpack:"-"` // Publisher topic, set by subscriber ("" if replayed)
 }
 
 // GetType returns the event type
@@ -88,6 +105,8 @@ type AllBlocksClearedEvent struct {
 	Timestamp time.Time `msgpack:"timestamp"`
 	ModelName string    `msgpack:"model_name"`
 	PodName   string    `msgpack:"-"` // Set by subscriber
+	DPRank    int       `msgpack:"-"` // Data parallel rank, set by subscriber
+	Topic     string    `msgpack:"-"` // Publisher topic, set by subscriber ("" if replayed)
 }
 
 // GetType returns the event type
@@ -102,5 +121,7 @@ func (e *AllBlocksClearedEvent) GetTimestamp() time.Time {
 
 // EventBatch represents a batch of events from vLLM
 type EventBatch struct {
-	Events []KVEvent `msgpack:"events"`
+	Timestamp        time.Time `msgpack:"ts"`
+	Events           []KVEvent `msgpack:"events"`
+	DataParallelRank *int      `msgpack:"data_parallel_rank,omitempty"` // nil if not reported
 }
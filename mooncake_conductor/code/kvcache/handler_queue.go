@@ -0,0 +1,205 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"context"
+	"sync"
+)
+
+// queuedBatch is a received batch waiting for the handler worker.
+// Synthesized and redecoded batches are queued already decoded; only
+// batches taken from the stream in order are sequenced.
+type queuedBatch struct {
+	topic     []byte
+	seq       int64
+	payload   []byte
+	batch     *EventBatch
+	sequenced bool
+	clear     bool // A synthesized AllBlocksCleared
+	evicted   bool // Batches right before this one were dropped by OverflowDropOldest
+	recovered bool // Redecoded from the dead letter store; payload is kept for requarantining
+}
+
+// handlerQueue is the bounded queue between a client's reader and its
+// handler worker. There is one worker per client, so batches of a
+// service are handled in sequence order.
+type handlerQueue struct {
+	capacity int
+	ready    chan struct{} // Signalled after a push
+	room     chan struct{} // Signalled after a pop
+
+	mu          sync.Mutex
+	items       []queuedBatch
+	highWater   int
+	dropped     uint64
+	pauses      uint64
+	paused      bool
+	overflowing bool
+}
+
+func newHandlerQueue(size int) *handlerQueue {
+	return &handlerQueue{
+		capacity: size,
+		ready:    make(chan struct{}, 1),
+		room:     make(chan struct{}, 1),
+		items:    make([]queuedBatch, 0, size),
+	}
+}
+
+// signal wakes whoever waits on ch, without blocking.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// push waits for room in the queue. It returns false if ctx is done first.
+func (q *handlerQueue) push(ctx context.Context, item queuedBatch) bool {
+	q.mu.Lock()
+	for len(q.items) >= q.capacity {
+		q.mu.Unlock()
+		select {
+		case <-q.room:
+		case <-ctx.Done():
+			return false
+		}
+		q.mu.Lock()
+	}
+	q.appendLocked(item, false)
+	q.mu.Unlock()
+	return true
+}
+
+// pushDropOldest queues item, discarding the oldest sequenced batch while
+// the queue is full. Synthesized and redecoded batches are never
+// discarded; if only those are queued it waits for room like push. The
+// batch after a discarded one is marked evicted, so the worker can treat
+// the loss like a gap. It reports whether a batch was discarded and whether
+// this is the first discard since the queue last had room.
+func (q *handlerQueue) pushDropOldest(ctx context.Context, item queuedBatch) (dropped, first bool) {
+	q.mu.Lock()
+	for len(q.items) >= q.capacity {
+		i := 0
+		for i < len(q.items) && !q.items[i].sequenced {
+			i++
+		}
+		if i == len(q.items) {
+			q.mu.Unlock()
+			q.push(ctx, item)
+			return dropped, false
+		}
+
+		if old := q.items[i]; old.batch != nil {
+			old.batch.Release()
+		}
+		copy(q.items[i:], q.items[i+1:])
+		q.items[len(q.items)-1] = queuedBatch{}
+		q.items = q.items[:len(q.items)-1]
+		if i < len(q.items) {
+			q.items[i].evicted = true
+		} else {
+			item.evicted = true
+		}
+		q.dropped++
+		dropped = true
+	}
+	first = q.appendLocked(item, dropped)
+	q.mu.Unlock()
+	return dropped, first
+}
+
+// pop takes the oldest queued batch, if there is one.
+func (q *handlerQueue) pop() (queuedBatch, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return queuedBatch{}, false
+	}
+	item := q.items[0]
+	q.items[0] = queuedBatch{}
+	q.items = q.items[1:]
+	signal(q.room)
+	return item, true
+}
+
+// appendLocked queues item, updates the high-water mark and tracks whether
+// the queue is overflowing. It returns true when overflowing just started.
+func (q *handlerQueue) appendLocked(item queuedBatch, overflowed bool) bool {
+	q.items = append(q.items, item)
+	signal(q.ready)
+
+	if len(q.items) > q.highWater {
+		q.highWater = len(q.items)
+	}
+	started := overflowed && !q.overflowing
+	q.overflowing = overflowed
+	return started
+}
+
+// admit decides whether a live batch may be queued under
+// OverflowPauseReplay. Reading pauses when the queue is full and resumes
+// once it is half empty. The returned change is +1 when reading just
+// paused, -1 when it just resumed and 0 otherwise.
+func (q *handlerQueue) admit() (ok bool, change int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	depth := len(q.items)
+	switch {
+	case q.paused && depth <= q.capacity/2:
+		q.paused = false
+		return true, -1
+	case q.paused:
+		return false, 0
+	case depth >= q.capacity:
+		q.paused = true
+		q.pauses++
+		return false, 1
+	}
+	return true, 0
+}
+
+// isPaused reports whether reading is paused by OverflowPauseReplay.
+func (q *handlerQueue) isPaused() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused
+}
+
+// resume ends a pause once the queue is half empty. It reports whether
+// reading was paused and may now continue.
+func (q *handlerQueue) resume() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.paused || len(q.items) > q.capacity/2 {
+		return false
+	}
+	q.paused = false
+	return true
+}
+
+// fillStatus adds the queue metrics to a client status.
+func (q *handlerQueue) fillStatus(status *ClientStatus) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	status.QueueDepth = len(q.items)
+	status.QueueCapacity = q.capacity
+	status.QueueHighWater = q.highWater
+	status.QueueDropped = q.dropped
+	status.QueuePauses = q.pauses
+}
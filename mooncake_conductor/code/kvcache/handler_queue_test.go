@@ -0,0 +1,117 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPushDropOldestKeepsSynthetic(t *testing.T) {
+	ctx := context.Background()
+	q := newHandlerQueue(3)
+	q.push(ctx, queuedBatch{batch: clearedBatch(), clear: true})
+	q.push(ctx, queuedBatch{seq: 1, sequenced: true})
+	q.push(ctx, queuedBatch{topic: []byte("redecoded"), batch: &EventBatch{}})
+
+	dropped, first := q.pushDropOldest(ctx, queuedBatch{seq: 2, sequenced: true})
+	if !dropped || !first {
+		t.Fatalf("pushDropOldest = %v, %v; want a first discard", dropped, first)
+	}
+
+	want := []struct {
+		seq     int64
+		clear   bool
+		evicted bool
+	}{
+		{clear: true},
+		{evicted: true}, // the redecoded batch after the discarded seq 1
+		{seq: 2},
+	}
+	for i, w := range want {
+		item, ok := q.pop()
+		if !ok {
+			t.Fatalf("queue ended after %d items", i)
+		}
+		if item.seq != w.seq || item.clear != w.clear || item.evicted != w.evicted {
+			t.Errorf("item %d = %+v, want %+v", i, item, w)
+		}
+	}
+	if _, ok := q.pop(); ok {
+		t.Error("queue not empty")
+	}
+}
+
+func TestPushDropOldestWaitsForSynthetic(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	q := newHandlerQueue(1)
+	q.push(ctx, queuedBatch{batch: clearedBatch(), clear: true})
+
+	// Only a synthesized batch is queued, so nothing may be discarded
+	if dropped, _ := q.pushDropOldest(ctx, queuedBatch{seq: 1, sequenced: true}); dropped {
+		t.Fatal("discarded a synthesized batch")
+	}
+	if item, _ := q.pop(); !item.clear {
+		t.Errorf("first item = %+v, want the clear", item)
+	}
+}
+
+// TestEvictionHandledAsGap checks that discarded batches are purged under
+// GapPolicyPurge and hold the handled sequence under GapPolicyIgnore.
+func TestEvictionHandledAsGap(t *testing.T) {
+	payload := testPayload(t)
+	for _, policy := range []GapPolicy{GapPolicyPurge, GapPolicyIgnore} {
+		t.Run(string(policy), func(t *testing.T) {
+			config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+			config.QueueSize = 2
+			config.OverflowPolicy = OverflowDropOldest
+			config.GapPolicy = policy
+			recorder := &eventRecorder{}
+			client := NewStaticZMQClient(config, recorder, nil)
+
+			// Queue without a worker, then let one drain the queue
+			for seq := int64(0); seq < 4; seq++ {
+				client.applyMessage(nil, seq, payload, true)
+			}
+			client.wg.Add(1)
+			go client.work()
+			defer client.Stop()
+
+			status := func() ClientStatus { return client.Status() }
+			waitUntil(t, "the queue drains", func() bool { return status().QueueDepth == 0 })
+			if dropped := status().QueueDropped; dropped != 2 {
+				t.Fatalf("dropped %d batches, want 2", dropped)
+			}
+
+			switch policy {
+			case GapPolicyPurge:
+				waitUntil(t, "seq 3 is handled", func() bool { return status().HandledSeq == 3 })
+				if _, ok := recorder.snapshot()[0].(*AllBlocksClearedEvent); !ok || recorder.count() != 1 {
+					t.Errorf("events = %v, want one clear", recorder.snapshot())
+				}
+			case GapPolicyIgnore:
+				time.Sleep(10 * time.Millisecond)
+				if seq := status().HandledSeq; seq != -1 {
+					t.Errorf("handled sequence = %d, want it held at -1", seq)
+				}
+				if n := recorder.count(); n != 0 {
+					t.Errorf("handled %d events, want none", n)
+				}
+			}
+		})
+	}
+}
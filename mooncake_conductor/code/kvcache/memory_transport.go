@@ -0,0 +1,296 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryTransport is a channel-backed Transport that stands in for a
+// publisher, so clients and the manager can be driven without sockets.
+// The test side publishes with Publish, Drop and SendRaw and injects failures with
+// FailConnect and Disconnect. Like a SUB socket, messages published while
+// the transport is not connected are lost, but they stay in the replay
+// buffer.
+type MemoryTransport struct {
+	mu sync.Mutex
+
+	messages chan [][]byte
+	replies  chan [][]byte
+	signal   chan struct{}
+
+	connected  bool
+	connects   int
+	connectErr error
+	recvErr    error
+	peer       *PeerStatus
+
+	// Replay buffer, oldest first, like vLLM's buffer_steps
+	buffer         []memoryBatch
+	bufferCapacity int
+	replayRequests []int64
+}
+
+type memoryBatch struct {
+	seq     int64
+	payload []byte
+}
+
+// NewMemoryTransport creates a MemoryTransport that queues up to queueSize
+// undelivered messages and can replay the last replayCapacity batches.
+func NewMemoryTransport(queueSize, replayCapacity int) *MemoryTransport {
+	if replayCapacity <= 0 {
+		replayCapacity = DefaultMaxGapReplay
+	}
+	return &MemoryTransport{
+		messages:       make(chan [][]byte, queueSize),
+		signal:         make(chan struct{}, 1),
+		bufferCapacity: replayCapacity,
+	}
+}
+
+// Connect implements Transport.
+func (t *MemoryTransport) Connect() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.connects++
+	if t.connectErr != nil {
+		return t.connectErr
+	}
+	t.connected = true
+	t.recvErr = nil
+	return nil
+}
+
+// Recv implements Transport.
+func (t *MemoryTransport) Recv(timeout time.Duration) ([][]byte, error) {
+	t.mu.Lock()
+	if err := t.recvErr; err != nil {
+		t.recvErr = nil
+		t.connected = false
+		t.mu.Unlock()
+		return nil, err
+	}
+	connected := t.connected
+	t.mu.Unlock()
+
+	if !connected {
+		return nil, ErrTransportClosed
+	}
+
+	if timeout <= 0 {
+		select {
+		case frames := <-t.messages:
+			return frames, nil
+		default:
+			return nil, nil
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case frames := <-t.messages:
+		return frames, nil
+	case <-timer.C:
+		return nil, nil
+	}
+}
+
+// Notify implements Notifier.
+func (t *MemoryTransport) Notify() (<-chan struct{}, func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.messages) > 0 || t.recvErr != nil || !t.connected {
+		return readyNow, func() {}
+	}
+	return t.signal, func() {}
+}
+
+// wake sets the Notify signal.
+func (t *MemoryTransport) wake() {
+	select {
+	case t.signal <- struct{}{}:
+	default:
+	}
+}
+
+// RequestReplay implements Transport. The response holds every buffered
+// batch from fromSeq on, followed by the end marker.
+func (t *MemoryTransport) RequestReplay(fromSeq int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.connected {
+		return ErrTransportClosed
+	}
+	t.replayRequests = append(t.replayRequests, fromSeq)
+
+	replies := make(chan [][]byte, len(t.buffer)+1)
+	for _, batch := range t.buffer {
+		if batch.seq >= fromSeq {
+			replies <- [][]byte{encodeSeq(batch.seq), batch.payload}
+		}
+	}
+	replies <- [][]byte{encodeSeq(replayEndSeq), {}}
+	t.replies = replies
+	return nil
+}
+
+// RecvReplay implements Transport.
+func (t *MemoryTransport) RecvReplay(timeout time.Duration) ([][]byte, error) {
+	t.mu.Lock()
+	replies := t.replies
+	t.mu.Unlock()
+
+	if replies == nil {
+		return nil, fmt.Errorf("no replay requested")
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case frames := <-replies:
+		return frames, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("replay response timed out after %v", timeout)
+	}
+}
+
+// PeerStatus implements Transport. Unless overridden with SetPeerStatus,
+// the publisher is reached as soon as the transport is connected.
+func (t *MemoryTransport) PeerStatus() PeerStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case !t.connected:
+		return PeerStatus{State: ConnectionStateDisconnected}
+	case t.peer != nil:
+		return *t.peer
+	}
+	return PeerStatus{State: ConnectionStateConnected}
+}
+
+// Close implements Transport. Undelivered messages are discarded.
+func (t *MemoryTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.connected = false
+	t.replies = nil
+	for {
+		select {
+		case <-t.messages:
+		default:
+			return nil
+		}
+	}
+}
+
+// Publish buffers a batch for replay and delivers it if the transport is
+// connected. It blocks while the delivery queue is full.
+func (t *MemoryTransport) Publish(topic []byte, seq int64, payload []byte) {
+	if t.record(seq, payload) {
+		t.messages <- [][]byte{topic, encodeSeq(seq), payload}
+		t.wake()
+	}
+}
+
+// Drop buffers a batch for replay without delivering it, simulating a
+// message lost on the way to the subscriber.
+func (t *MemoryTransport) Drop(seq int64, payload []byte) {
+	t.record(seq, payload)
+}
+
+// SendRaw delivers frames as they are, without buffering them for replay,
+// e.g. a malformed message. Like Publish it needs a connected transport.
+func (t *MemoryTransport) SendRaw(frames ...[]byte) {
+	if t.Connected() {
+		t.messages <- frames
+		t.wake()
+	}
+}
+
+// record adds a batch to the replay buffer and reports whether it should
+// be delivered.
+func (t *MemoryTransport) record(seq int64, payload []byte) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buffer = append(t.buffer, memoryBatch{seq: seq, payload: payload})
+	if len(t.buffer) > t.bufferCapacity {
+		t.buffer = t.buffer[len(t.buffer)-t.bufferCapacity:]
+	}
+	return t.connected
+}
+
+// FailConnect makes every Connect fail with err until it is called with nil.
+func (t *MemoryTransport) FailConnect(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connectErr = err
+}
+
+// Disconnect makes the next Recv fail with err, as a broken socket would.
+func (t *MemoryTransport) Disconnect(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recvErr = err
+	t.wake()
+}
+
+// SetPeerStatus overrides what PeerStatus reports while the transport is
+// connected, e.g. a publisher that cannot be reached. Nil restores the default.
+func (t *MemoryTransport) SetPeerStatus(status *PeerStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.peer = status
+	t.wake()
+}
+
+// Connected reports whether the transport is connected.
+func (t *MemoryTransport) Connected() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connected
+}
+
+// Connects returns how many times Connect was called.
+func (t *MemoryTransport) Connects() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.connects
+}
+
+// ReplayRequests returns the start sequence of every replay request so far.
+func (t *MemoryTransport) ReplayRequests() []int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]int64(nil), t.replayRequests...)
+}
+
+func encodeSeq(seq int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(seq))
+	return b
+}
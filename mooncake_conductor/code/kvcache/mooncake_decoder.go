@@ -0,0 +1,241 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Mooncake Store object notifications travel on the same [topic, seq,
+// payload] envelope as vLLM events. The payload layout below is defined by
+// this package rather than taken from a Mooncake Store release: Mooncake
+// Store (github.com/kvcache-ai/Mooncake) does not publish KV events itself,
+// so the notifier running next to the store has to produce it, and
+// EncodeMooncakeBatch is its reference encoder. The payload is MessagePack:
+//
+//	[ts, notifications]
+//	notification: [op, keys, tier]
+//
+// op is one of the MooncakeOp constants, keys is an array of object keys and
+// tier is the replica type holding the objects ("MEMORY" or "DISK"; nil or
+// omitted means MEMORY). RemoveAll carries no keys. Notifiers have no replay
+// buffer, so Mooncake services get no replay endpoint unless configured.
+
+// MooncakeOp is the operation of a Mooncake Store object notification
+type MooncakeOp string
+
+const (
+	MooncakeOpPut       MooncakeOp = "Put"
+	MooncakeOpRemove    MooncakeOp = "Remove"
+	MooncakeOpRemoveAll MooncakeOp = "RemoveAll"
+)
+
+// Mooncake Store replica tiers
+const (
+	MooncakeTierMemory = "MEMORY"
+	MooncakeTierDisk   = "DISK"
+)
+
+// MooncakeNotification is a single object notification from Mooncake Store.
+type MooncakeNotification struct {
+	Op   MooncakeOp
+	Keys []string
+	Tier string
+}
+
+func init() {
+	RegisterDecoder(ServiceTypeMooncake, func(*ZMQClientConfig) (Decoder, error) {
+		return DecoderFunc(DecodeMooncakeBatch), nil
+	})
+}
+
+// DecodeMooncakeBatch decodes Mooncake Store notifications into KV events.
+// Puts become BlockStoredEvents and removals BlockRemovedEvents, each with
+// Medium set to the storage tier (MediumMooncakeMemory or MediumMooncakeDisk).
+func DecodeMooncakeBatch(data []byte) (*EventBatch, error) {
+	r := getReader(data)
+	defer putReader(r)
+
+	n, err := r.readArrayHeader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal mooncake batch: %w", err)
+	}
+	if n < 2 {
+		return nil, fmt.Errorf("expected at least 2-element array, got %d", n)
+	}
+
+	ts, err := r.readTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse batch timestamp: %w", err)
+	}
+
+	count, err := r.readArrayHeader()
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications structure: %w", err)
+	}
+
+	batch := &EventBatch{
+		Timestamp: ts,
+		Events:    getEventSlice(count),
+	}
+
+	for i := 0; i < count; i++ {
+		event, err := decodeMooncakeNotification(r, ts)
+		if err != nil {
+			batch.Release()
+			return nil, fmt.Errorf("failed to parse notification at index %d: %w", i, err)
+		}
+		batch.Events = append(batch.Events, event)
+	}
+
+	if err := r.skipN(n - 2); err != nil {
+		batch.Release()
+		return nil, fmt.Errorf("failed to skip trailing batch fields: %w", err)
+	}
+
+	return batch, nil
+}
+
+func decodeMooncakeNotification(r *msgpackReader, ts time.Time) (KVEvent, error) {
+	fields, err := r.readArrayHeader()
+	if err != nil {
+		return nil, fmt.Errorf("notification is not an array: %w", err)
+	}
+	if fields == 0 {
+		return nil, fmt.Errorf("empty notification array")
+	}
+
+	op, err := r.readStringBytes()
+	if err != nil {
+		return nil, fmt.Errorf("missing or invalid op: %w", err)
+	}
+
+	if MooncakeOp(op) == MooncakeOpRemoveAll {
+		if err := r.skipN(fields - 1); err != nil {
+			return nil, err
+		}
+		return &AllBlocksClearedEvent{
+			Type:      EventTypeAllCleared,
+			Timestamp: ts,
+		}, nil
+	}
+
+	if fields < 2 {
+		return nil, fmt.Errorf("%s expects keys, got %d fields", op, fields)
+	}
+
+	hashes, err := readMooncakeKeys(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse keys: %w", err)
+	}
+
+	tier := ""
+	if fields > 2 {
+		if tier, err = r.readOptionalString(); err != nil {
+			return nil, fmt.Errorf("failed to parse tier: %w", err)
+		}
+	}
+	if err := r.skipN(fields - 3); err != nil {
+		return nil, err
+	}
+
+	switch MooncakeOp(op) {
+	case MooncakeOpPut:
+		return &BlockStoredEvent{
+			Type:        EventTypeBlockStored,
+			Timestamp:   ts,
+			BlockHashes: hashes,
+			Medium:      mooncakeMedium(tier),
+		}, nil
+	case MooncakeOpRemove:
+		return &BlockRemovedEvent{
+			Type:        EventTypeBlockRemoved,
+			Timestamp:   ts,
+			BlockHashes: hashes,
+			Medium:      mooncakeMedium(tier),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown mooncake op: %s", op)
+	}
+}
+
+// readMooncakeKeys reads object keys as block hashes. Decimal keys (as
+// written by the vLLM Mooncake connector for integer hashes) map to integer
+// hashes so they match the engine's own events; other keys are kept as bytes.
+func readMooncakeKeys(r *msgpackReader) ([]BlockHash, error) {
+	n, err := r.readArrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]BlockHash, n)
+	for i := range result {
+		key, err := r.readStringBytes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key at index %d: %w", i, err)
+		}
+		result[i] = MooncakeKeyHash(string(key))
+	}
+	return result, nil
+}
+
+// MooncakeKeyHash converts a Mooncake Store object key into a BlockHash.
+func MooncakeKeyHash(key string) BlockHash {
+	if v, err := strconv.ParseInt(key, 10, 64); err == nil {
+		return Int64BlockHash(v)
+	}
+	return BytesBlockHash([]byte(key))
+}
+
+func mooncakeMedium(tier string) string {
+	switch tier {
+	case "", MooncakeTierMemory:
+		return MediumMooncakeMemory
+	case MooncakeTierDisk:
+		return MediumMooncakeDisk
+	default:
+		return "MOONCAKE_" + tier
+	}
+}
+
+// EncodeMooncakeBatch encodes notifications in the Mooncake Store wire
+// format. It is the inverse of DecodeMooncakeBatch and is used by fake
+// publishers.
+func EncodeMooncakeBatch(ts time.Time, notifications []MooncakeNotification) []byte {
+	w := &msgpackWriter{}
+	w.writeArrayHeader(2)
+	w.writeFloat64(float64(ts.UnixNano()) / 1e9)
+	w.writeArrayHeader(len(notifications))
+	for _, n := range notifications {
+		if n.Op == MooncakeOpRemoveAll {
+			w.writeArrayHeader(1)
+			w.writeString(string(n.Op))
+			continue
+		}
+		w.writeArrayHeader(3)
+		w.writeString(string(n.Op))
+		w.writeArrayHeader(len(n.Keys))
+		for _, key := range n.Keys {
+			w.writeString(key)
+		}
+		if n.Tier == "" {
+			w.writeNil()
+		} else {
+			w.writeString(n.Tier)
+		}
+	}
+	return w.buf
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// mooncakePayload is a notification batch written out byte by byte:
+// [1700000000.5, [["Put", ["123", "obj-a"], "DISK"], ["Remove", ["123"], nil], ["RemoveAll"]]]
+var mooncakePayload = []byte("" +
+	"\x92" + // [ts, notifications]
+	"\xcb\x41\xd9\x54\xfc\x40\x20\x00\x00" + // float64 1700000000.5
+	"\x93" +
+	"\x93\xa3Put\x92\xa3123\xa5obj-a\xa4DISK" +
+	"\x93\xa6Remove\x91\xa3123\xc0" +
+	"\x91\xa9RemoveAll")
+
+func TestDecodeMooncakeBatch(t *testing.T) {
+	batch, err := DecodeMooncakeBatch(mooncakePayload)
+	if err != nil {
+		t.Fatalf("failed to decode batch: %v", err)
+	}
+	defer batch.Release()
+
+	if want := time.Unix(1700000000, 500000000); !batch.Timestamp.Equal(want) {
+		t.Errorf("timestamp = %v, want %v", batch.Timestamp, want)
+	}
+	if len(batch.Events) != 3 {
+		t.Fatalf("decoded %d events, want 3", len(batch.Events))
+	}
+
+	stored, ok := batch.Events[0].(*BlockStoredEvent)
+	if !ok {
+		t.Fatalf("event 0 is %T, want *BlockStoredEvent", batch.Events[0])
+	}
+	wantHashes := []BlockHash{Int64BlockHash(123), BytesBlockHash([]byte("obj-a"))}
+	if len(stored.BlockHashes) != 2 || stored.BlockHashes[0] != wantHashes[0] || stored.BlockHashes[1] != wantHashes[1] {
+		t.Errorf("stored hashes = %v, want %v", stored.BlockHashes, wantHashes)
+	}
+	if stored.Medium != MediumMooncakeDisk {
+		t.Errorf("stored medium = %q, want %q", stored.Medium, MediumMooncakeDisk)
+	}
+
+	removed, ok := batch.Events[1].(*BlockRemovedEvent)
+	if !ok {
+		t.Fatalf("event 1 is %T, want *BlockRemovedEvent", batch.Events[1])
+	}
+	if len(removed.BlockHashes) != 1 || removed.BlockHashes[0] != Int64BlockHash(123) {
+		t.Errorf("removed hashes = %v, want [123]", removed.BlockHashes)
+	}
+	if removed.Medium != MediumMooncakeMemory {
+		t.Errorf("removed medium = %q, want %q (nil tier)", removed.Medium, MediumMooncakeMemory)
+	}
+
+	if _, ok := batch.Events[2].(*AllBlocksClearedEvent); !ok {
+		t.Errorf("event 2 is %T, want *AllBlocksClearedEvent", batch.Events[2])
+	}
+}
+
+func TestEncodeMooncakeBatch(t *testing.T) {
+	got := EncodeMooncakeBatch(time.Unix(1700000000, 500000000), []MooncakeNotification{
+		{Op: MooncakeOpPut, Keys: []string{"123", "obj-a"}, Tier: MooncakeTierDisk},
+		{Op: MooncakeOpRemove, Keys: []string{"123"}},
+		{Op: MooncakeOpRemoveAll},
+	})
+	if !bytes.Equal(got, mooncakePayload) {
+		t.Errorf("encoded batch differs:\n got %x\nwant %x", got, mooncakePayload)
+	}
+}
+
+func TestDecodeMooncakeBatchErrors(t *testing.T) {
+	cases := map[string][]byte{
+		"not an array":     []byte("\xa3abc"),
+		"missing events":   []byte("\x91\xcb\x41\xd9\x54\xfc\x40\x20\x00\x00"),
+		"unknown op":       []byte("\x92\x00\x91\x92\xa4Move\x90"),
+		"put without keys": []byte("\x92\x00\x91\x91\xa3Put"),
+		"truncated":        mooncakePayload[:len(mooncakePayload)-3],
+	}
+	for name, payload := range cases {
+		if _, err := DecodeMooncakeBatch(payload); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// TestMooncakeFakePublisher drives a client through a MemoryTransport
+// standing in for a Mooncake notifier.
+func TestMooncakeFakePublisher(t *testing.T) {
+	config := DefaultZMQClientConfig("mooncake-0", "127.0.0.1", "")
+	config.RouterPort = 0
+	decoder, err := NewDecoder(ServiceTypeMooncake, config)
+	if err != nil {
+		t.Fatalf("failed to create decoder: %v", err)
+	}
+
+	transport := NewMemoryTransport(16, 16)
+	recorder := &eventRecorder{}
+	client := NewStaticZMQClient(config, recorder, decoder)
+	client.SetTransport(transport)
+	if err := client.Start(); err != nil {
+		t.Fatalf("failed to start client: %v", err)
+	}
+	defer client.Stop()
+
+	transport.Publish([]byte("mooncake"), 0, EncodeMooncakeBatch(time.Now(), []MooncakeNotification{
+		{Op: MooncakeOpPut, Keys: []string{"1", "2"}, Tier: MooncakeTierMemory},
+	}))
+	transport.Publish([]byte("mooncake"), 1, EncodeMooncakeBatch(time.Now(), []MooncakeNotification{
+		{Op: MooncakeOpRemove, Keys: []string{"1"}, Tier: MooncakeTierMemory},
+	}))
+
+	waitUntil(t, "both notifications are handled", func() bool { return recorder.count() == 2 })
+	events := recorder.snapshot()
+	stored, ok := events[0].(*BlockStoredEvent)
+	if !ok || stored.PodName != "mooncake-0" || stored.Topic != "mooncake" || len(stored.BlockHashes) != 2 {
+		t.Errorf("unexpected stored event: %#v", events[0])
+	}
+	if _, ok := events[1].(*BlockRemovedEvent); !ok {
+		t.Errorf("event 1 is %T, want *BlockRemovedEvent", events[1])
+	}
+}
@@ -16,328 +16,334 @@ package kvcache
 
 import (
 	"fmt"
-	// "time"
-	"log/slog"
-
-	msgpack "github.com/shamaton/msgpack/v2"
+	"sync"
+	"time"
 )
 
-// DecodeEventBatch decodes a MessagePack encoded event batch
-func DecodeEventBatch(data []byte) (*EventBatch, error) {
-	// 当前传入的data是[timestamp, events, status]
+// eventSlicePool recycles the Events backing arrays of decoded batches.
+var eventSlicePool = sync.Pool{
+	New: func() interface{} {
+		s := make([]KVEvent, 0, 16)
+		return &s
+	},
+}
 
-	var arr []interface{}
+// DecodeEventBatch decodes a MessagePack encoded event batch.
+//
+// vLLM encodes KVEventBatch as an array-like struct: [ts, events, data_parallel_rank].
+// Trailing fields equal to their default are omitted by the encoder, so the
+// rank may be missing entirely.
+//
+// The payload is walked in place; no intermediate []interface{} tree is built.
+// Callers should call Release on the returned batch once its events have been
+// handled so the Events slice can be reused.
+func DecodeEventBatch(data []byte) (*EventBatch, error) {
+	return DecodeEventBatchWithFormat(data, WireFormatAuto)
+}
 
-	if len(data) > 0 {
-		slog.Info("First byte of payload", "hex", fmt.Sprintf("%02x", data[0]))
+// DecodeEventBatchWithFormat decodes an event batch using the named wire
+// format. An empty name or WireFormatAuto detects the format per event.
+func DecodeEventBatchWithFormat(data []byte, formatName string) (*EventBatch, error) {
+	format, err := LookupWireFormat(formatName)
+	if err != nil {
+		return nil, err
 	}
+	return decodeEventBatch(data, format)
+}
 
-	if err := msgpack.Unmarshal(data, &arr); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal event batch: %w", err)
-	}
+// decodeEventBatch decodes a batch with a resolved format; nil auto-detects.
+func decodeEventBatch(data []byte, format *WireFormat) (*EventBatch, error) {
+	r := getReader(data)
+	defer putReader(r)
 
-	if len(arr) != 3 {
-		return nil, fmt.Errorf("expected 3-element array, got %d", len(arr))
+	n, err := r.readArrayHeader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event batch: %w", err)
 	}
-
-	for i, elem := range arr {
-		slog.Info("Array element", "index", i, "type", fmt.Sprintf("%T", elem), "value", elem)
+	if n < 2 {
+		return nil, fmt.Errorf("expected at least 2-element array, got %d", n)
 	}
 
-	eventsRaw := map[string]interface{}{
-		"timestamp": arr[0],
-		"event":     arr[1],
-		"status":    arr[2],
+	ts, err := r.readTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse batch timestamp: %w", err)
 	}
 
-	eventRaw, ok := eventsRaw["event"].([]interface{})
-	if !ok || len(eventsRaw) == 0 {
-		return nil, fmt.Errorf("invalid event structure: expected non-empty []interface{}")
+	numEvents, err := r.readArrayHeader()
+	if err != nil {
+		return nil, fmt.Errorf("invalid events structure: %w", err)
 	}
 
 	batch := &EventBatch{
-		Events: make([]KVEvent, 0, len(eventRaw)),
+		Timestamp: ts,
+		Events:    getEventSlice(numEvents),
 	}
 
-	for i, subeventRaw := range eventRaw {
-		event, ok := subeventRaw.([]interface{})
-		if !ok {
-			return nil, fmt.Errorf("subeventRaw is not a slice: %T", subeventRaw)
-		}
-		res, err := parseEvent(event)
+	for i := 0; i < numEvents; i++ {
+		event, err := decodeEvent(r, ts, format)
 		if err != nil {
+			batch.Release()
 			return nil, fmt.Errorf("failed to parse event at index %d: %w", i, err)
 		}
+		batch.Events = append(batch.Events, event)
+	}
+
+	if n > 2 {
+		if r.isNil() {
+			_ = r.readNil()
+		} else {
+			rank, err := r.readInt64()
+			if err != nil {
+				batch.Release()
+				return nil, fmt.Errorf("failed to parse data_parallel_rank: %w", err)
+			}
+			dpRank := int(rank)
+			batch.DataParallelRank = &dpRank
+		}
+	}
 
-		batch.Events = append(batch.Events, res)
+	// Tolerate fields appended by newer publishers
+	if n > 3 {
+		if err := r.skipN(n - 3); err != nil {
+			batch.Release()
+			return nil, fmt.Errorf("failed to skip trailing batch fields: %w", err)
+		}
 	}
 
 	return batch, nil
 }
 
-// parseEvent parses a single event from raw data
-func parseEvent(raw interface{}) (KVEvent, error) {
-	// Handle both map[string]interface{} and map[interface{}]interface{}
+// Release returns the batch's Events slice to the decoder pool.
+// The events themselves are not recycled and remain valid after Release.
+func (b *EventBatch) Release() {
+	if b == nil || b.Events == nil {
+		return
+	}
+	events := b.Events
+	for i := range events {
+		events[i] = nil
+	}
+	events = events[:0]
+	b.Events = nil
+	eventSlicePool.Put(&events)
+}
 
-	subevent, ok := raw.([]interface{})
-	if !ok {
-		fmt.Errorf("subevent is not a slice: %T", subevent)
+func getEventSlice(n int) []KVEvent {
+	events := *eventSlicePool.Get().(*[]KVEvent)
+	if cap(events) < n {
+		return make([]KVEvent, 0, n)
+	}
+	return events[:0]
+}
+
+// decodeEvent decodes a single tagged event.
+// vLLM encodes each event as [tag, field1, field2, ...].
+// A nil format selects the layout from the number of fields.
+func decodeEvent(r *msgpackReader, ts time.Time, format *WireFormat) (KVEvent, error) {
+	fields, err := r.readArrayHeader()
+	if err != nil {
+		return nil, fmt.Errorf("event is not an array: %w", err)
+	}
+	if fields == 0 {
+		return nil, fmt.Errorf("empty event array")
 	}
 
-	eventType, ok := subevent[0].(string)
-	if !ok {
-		fmt.Errorf("missing event type")
+	tag, err := r.readStringBytes()
+	if err != nil {
+		return nil, fmt.Errorf("missing or invalid event type: %w", err)
 	}
 
-	// slog.Info("Raw eventType bytes:", "bytes", eventType)
-	// slog.Info("Raw eventType bytes:", "bytes", eventType)
-	// fmt.Printf("Raw eventType bytes: %s\n", eventType)
+	eventType := EventType(tag)
+	if format == nil && eventType != EventTypeAllCleared {
+		if format = detectWireFormat(eventType, fields-1); format == nil {
+			return nil, fmt.Errorf("no wire format registered")
+		}
+	}
 
-	switch EventType(eventType) {
+	switch eventType {
 	case EventTypeBlockStored:
-		return parseBlockStoredEvent(subevent)
-	// case EventTypeBlockRemoved:
-	// 	return parseBlockRemovedEvent(subevent)
-	// case EventTypeAllCleared:
-	// 	return parseAllBlocksClearedEvent(subevent)
+		return decodeBlockStoredEvent(r, fields-1, ts, format.BlockStored)
+	case EventTypeBlockRemoved:
+		return decodeBlockRemovedEvent(r, fields-1, ts, format.BlockRemoved)
+	case EventTypeAllCleared:
+		return decodeAllBlocksClearedEvent(r, fields, ts)
 	default:
-		return nil, fmt.Errorf("unknown event type: %s", eventType)
+		return nil, fmt.Errorf("unknown event type: %s", tag)
 	}
 }
 
-// // parseBlockStoredEvent parses a BlockStoredEvent from raw data
-func parseBlockStoredEvent(data []interface{}) (*BlockStoredEvent, error) {
+// decodeBlockStoredEvent decodes the fields of a BlockStoredEvent following layout.
+func decodeBlockStoredEvent(r *msgpackReader, fields int, ts time.Time, layout []EventField) (*BlockStoredEvent, error) {
 	event := &BlockStoredEvent{
-		Type: EventTypeBlockStored,
-	}
-
-	slog.Info("succcesss parseBlockStoredEvent")
-	for i, elem := range data {
-		slog.Info("Array element", "index", i, "type", fmt.Sprintf("%T", elem), "value", elem)
-	}
-	// Parse timestamp
-	// if ts, err := parseTimestamp(data["timestamp"]); err == nil {
-	// 	event.Timestamp = ts
-	// } else {
-	// 	return nil, fmt.Errorf("failed to parse timestamp: %w", err)
-	// }
-
-	// // Parse model name
-	// if modelName, ok := data["model_name"].(string); ok {
-	// 	event.ModelName = modelName
-	// } else {
-	// 	return nil, fmt.Errorf("missing or invalid model_name")
-	// }
-
-	// // Parse block hashes
-	// if hashes, err := parseInt64Array(data["block_hashes"]); err == nil {
-	// 	event.BlockHashes = hashes
-	// } else {
-	// 	return nil, fmt.Errorf("failed to parse block_hashes: %w", err)
-	// }
-
-	// // Parse token IDs (array of arrays)
-	// if tokenIDsRaw, ok := data["token_ids"].([]interface{}); ok {
-	// 	event.TokenIDs = make([][]int32, 0, len(tokenIDsRaw))
-	// 	for i, tokensRaw := range tokenIDsRaw {
-	// 		tokens, err := parseInt32Array(tokensRaw)
-	// 		if err != nil {
-	// 			return nil, fmt.Errorf("failed to parse token_ids at index %d: %w", i, err)
-	// 		}
-	// 		event.TokenIDs = append(event.TokenIDs, tokens)
-	// 	}
-	// } else {
-	// 	return nil, fmt.Errorf("missing or invalid token_ids")
-	// }
-
-	// // Parse optional parent block hash
-	// if parentHash, ok := data["parent_block_hash"]; ok && parentHash != nil {
-	// 	hash, err := parseInt64(parentHash)
-	// 	if err != nil {
-	// 		return nil, fmt.Errorf("failed to parse parent_block_hash: %w", err)
-	// 	}
-	// 	event.ParentBlockHash = &hash
-	// }
+		Type:      EventTypeBlockStored,
+		Timestamp: ts,
+	}
+
+	var tokens []int32
+	seen := 0
+	for i := 0; i < fields; i++ {
+		if i >= len(layout) {
+			if err := r.skip(); err != nil {
+				return nil, fmt.Errorf("failed to skip BlockStored field %d: %w", i, err)
+			}
+			continue
+		}
+
+		var err error
+		switch layout[i] {
+		case FieldBlockHashes:
+			event.BlockHashes, err = readBlockHashes(r)
+		case FieldParentBlockHash:
+			event.ParentBlockHash, err = readOptionalBlockHash(r)
+		case FieldTokenIDs:
+			tokens, err = r.readInt32Array()
+		case FieldBlockSize:
+			var size *int64
+			if size, err = r.readOptionalInt64(); size != nil {
+				event.BlockSize = int(*size)
+			}
+		case FieldLoraID:
+			event.LoraID, err = r.readOptionalInt64()
+		case FieldMedium:
+			event.Medium, err = r.readOptionalString()
+		case FieldLoraName:
+			event.LoraName, err = r.readOptionalString()
+		default:
+			err = r.skip()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse BlockStored %s: %w", layout[i], err)
+		}
+		seen |= 1 << layout[i]
+	}
+
+	required := 1<<FieldBlockHashes | 1<<FieldTokenIDs
+	if seen&required != required {
+		return nil, fmt.Errorf("BlockStored is missing block_hashes or token_ids (%d fields)", fields)
+	}
+
+	// vLLM sends a flat token list covering all blocks, which is
+	// split into one array per block using block_size.
+	event.TokenIDs = splitTokenIDs(tokens, event.BlockSize, len(event.BlockHashes))
 
 	return event, nil
 }
 
-// // parseBlockRemovedEvent parses a BlockRemovedEvent from raw data
-// func parseBlockRemovedEvent(data map[string]interface{}) (*BlockRemovedEvent, error) {
-// 	event := &BlockRemovedEvent{
-// 		Type: EventTypeBlockRemoved,
-// 	}
-
-// 	// Parse timestamp
-// 	if ts, err := parseTimestamp(data["timestamp"]); err == nil {
-// 		event.Timestamp = ts
-// 	} else {
-// 		return nil, fmt.Errorf("failed to parse timestamp: %w", err)
-// 	}
-
-// 	// Parse model name
-// 	if modelName, ok := data["model_name"].(string); ok {
-// 		event.ModelName = modelName
-// 	} else {
-// 		return nil, fmt.Errorf("missing or invalid model_name")
-// 	}
-
-// 	// Parse block hashes
-// 	if hashes, err := parseInt64Array(data["block_hashes"]); err == nil {
-// 		event.BlockHashes = hashes
-// 	} else {
-// 		return nil, fmt.Errorf("failed to parse block_hashes: %w", err)
-// 	}
-
-// 	return event, nil
-// }
-
-// // parseAllBlocksClearedEvent parses an AllBlocksClearedEvent from raw data
-// func parseAllBlocksClearedEvent(data map[string]interface{}) (*AllBlocksClearedEvent, error) {
-// 	event := &AllBlocksClearedEvent{
-// 		Type: EventTypeAllCleared,
-// 	}
-
-// 	// Parse timestamp
-// 	if ts, err := parseTimestamp(data["timestamp"]); err == nil {
-// 		event.Timestamp = ts
-// 	} else {
-// 		return nil, fmt.Errorf("failed to parse timestamp: %w", err)
-// 	}
-
-// 	// Parse model name
-// 	if modelName, ok := data["model_name"].(string); ok {
-// 		event.ModelName = modelName
-// 	} else {
-// 		return nil, fmt.Errorf("missing or invalid model_name")
-// 	}
-
-// 	return event, nil
-// }
-
-// // Helper functions for parsing common types
-// func parseTimestamp(v interface{}) (time.Time, error) {
-// 	switch t := v.(type) {
-// 	case time.Time:
-// 		return t, nil
-// 	case int64:
-// 		// Unix timestamp in seconds
-// 		return time.Unix(t, 0).UTC(), nil
-// 	case int:
-// 		// Unix timestamp in seconds
-// 		return time.Unix(int64(t), 0).UTC(), nil
-// 	case int32:
-// 		// Unix timestamp in seconds
-// 		return time.Unix(int64(t), 0).UTC(), nil
-// 	case uint32:
-// 		// Unix timestamp in seconds
-// 		return time.Unix(int64(t), 0).UTC(), nil
-// 	case uint64:
-// 		// Unix timestamp in seconds
-// 		return time.Unix(int64(t), 0).UTC(), nil
-// 	case float64:
-// 		// Unix timestamp with fractional seconds
-// 		sec := int64(t)
-// 		nsec := int64((t - float64(sec)) * 1e9)
-// 		return time.Unix(sec, nsec).UTC().Truncate(time.Microsecond), nil
-// 	case float32:
-// 		// Unix timestamp with fractional seconds
-// 		f64 := float64(t)
-// 		sec := int64(f64)
-// 		nsec := int64((f64 - float64(sec)) * 1e9)
-// 		return time.Unix(sec, nsec).UTC().Truncate(time.Microsecond), nil
-// 	case string:
-// 		// Try to parse RFC3339 format
-// 		return time.Parse(time.RFC3339, t)
-// 	default:
-// 		return time.Time{}, fmt.Errorf("unsupported timestamp type: %T", v)
-// 	}
-// }
-
-// func parseInt64(v interface{}) (int64, error) {
-// 	switch n := v.(type) {
-// 	case int64:
-// 		return n, nil
-// 	case int:
-// 		return int64(n), nil
-// 	case int32:
-// 		return int64(n), nil
-// 	case int16:
-// 		return int64(n), nil
-// 	case int8:
-// 		return int64(n), nil
-// 	case uint:
-// 		return int64(n), nil
-// 	case uint64:
-// 		return int64(n), nil
-// 	case uint32:
-// 		return int64(n), nil
-// 	case uint16:
-// 		return int64(n), nil
-// 	case uint8:
-// 		return int64(n), nil
-// 	case float64:
-// 		return int64(n), nil
-// 	case float32:
-// 		return int64(n), nil
-// 	default:
-// 		return 0, fmt.Errorf("unsupported int64 type: %T", v)
-// 	}
-// }
-
-// func parseInt64Array(v interface{}) ([]int64, error) {
-// 	arr, ok := v.([]interface{})
-// 	if !ok {
-// 		return nil, fmt.Errorf("expected array, got %T", v)
-// 	}
-
-// 	result := make([]int64, 0, len(arr))
-// 	for i, item := range arr {
-// 		val, err := parseInt64(item)
-// 		if err != nil {
-// 			return nil, fmt.Errorf("failed to parse element at index %d: %w", i, err)
-// 		}
-// 		result = append(result, val)
-// 	}
-// 	return result, nil
-// }
-
-// func parseInt32Array(v interface{}) ([]int32, error) {
-// 	arr, ok := v.([]interface{})
-// 	if !ok {
-// 		return nil, fmt.Errorf("expected array, got %T", v)
-// 	}
-
-// 	result := make([]int32, 0, len(arr))
-// 	for i, item := range arr {
-// 		switch n := item.(type) {
-// 		case int32:
-// 			result = append(result, n)
-// 		case int:
-// 			result = append(result, int32(n))
-// 		case int64:
-// 			result = append(result, int32(n))
-// 		case int16:
-// 			result = append(result, int32(n))
-// 		case int8:
-// 			result = append(result, int32(n))
-// 		case uint:
-// 			result = append(result, int32(n))
-// 		case uint64:
-// 			result = append(result, int32(n))
-// 		case uint32:
-// 			result = append(result, int32(n))
-// 		case uint16:
-// 			result = append(result, int32(n))
-// 		case uint8:
-// 			result = append(result, int32(n))
-// 		case float64:
-// 			result = append(result, int32(n))
-// 		case float32:
-// 			result = append(result, int32(n))
-// 		default:
-// 			return nil, fmt.Errorf("unsupported int32 type at index %d: %T", i, item)
-// 		}
-// 	}
-// 	return result, nil
-// }
+// decodeBlockRemovedEvent decodes the fields of a BlockRemovedEvent following layout.
+func decodeBlockRemovedEvent(r *msgpackReader, fields int, ts time.Time, layout []EventField) (*BlockRemovedEvent, error) {
+	event := &BlockRemovedEvent{
+		Type:      EventTypeBlockRemoved,
+		Timestamp: ts,
+	}
+
+	seen := false
+	for i := 0; i < fields; i++ {
+		if i >= len(layout) {
+			if err := r.skip(); err != nil {
+				return nil, fmt.Errorf("failed to skip BlockRemoved field %d: %w", i, err)
+			}
+			continue
+		}
+
+		var err error
+		switch layout[i] {
+		case FieldBlockHashes:
+			event.BlockHashes, err = readBlockHashes(r)
+			seen = true
+		case FieldMedium:
+			event.Medium, err = r.readOptionalString()
+		default:
+			err = r.skip()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse BlockRemoved %s: %w", layout[i], err)
+		}
+	}
+
+	if !seen {
+		return nil, fmt.Errorf("BlockRemoved is missing block_hashes (%d fields)", fields)
+	}
+
+	return event, nil
+}
+
+// decodeAllBlocksClearedEvent decodes an AllBlocksClearedEvent.
+// Layout: ["AllBlocksCleared"]
+func decodeAllBlocksClearedEvent(r *msgpackReader, fields int, ts time.Time) (*AllBlocksClearedEvent, error) {
+	if err := r.skipN(fields - 1); err != nil {
+		return nil, fmt.Errorf("failed to skip AllBlocksCleared fields: %w", err)
+	}
+
+	return &AllBlocksClearedEvent{
+		Type:      EventTypeAllCleared,
+		Timestamp: ts,
+	}, nil
+}
+
+// readBlockHashes reads an array of block hashes.
+func readBlockHashes(r *msgpackReader) ([]BlockHash, error) {
+	n, err := r.readArrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]BlockHash, n)
+	for i := range result {
+		if result[i], err = readBlockHash(r); err != nil {
+			return nil, fmt.Errorf("failed to parse element at index %d: %w", i, err)
+		}
+	}
+	return result, nil
+}
+
+// readOptionalBlockHash reads a block hash or nil.
+func readOptionalBlockHash(r *msgpackReader) (*BlockHash, error) {
+	if r.isNil() {
+		return nil, r.readNil()
+	}
+	hash, err := readBlockHash(r)
+	if err != nil {
+		return nil, err
+	}
+	return &hash, nil
+}
+
+// readBlockHash reads an integer hash, or a bytes hash (vLLM 0.11+ with
+// sha256 or sha256_cbor hashing).
+func readBlockHash(r *msgpackReader) (BlockHash, error) {
+	c, err := r.peek()
+	if err != nil {
+		return BlockHash{}, err
+	}
+	if c < mpBin8 || c > mpBin32 {
+		v, err := r.readInt64()
+		return Int64BlockHash(v), err
+	}
+
+	b, err := r.readBinary()
+	if err != nil {
+		return BlockHash{}, err
+	}
+	return BytesBlockHash(b), nil
+}
+
+// splitTokenIDs splits a flat token list into one array per block.
+// If the block size is unknown, it is derived from the number of blocks.
+// The per-block arrays share the backing array of tokens.
+func splitTokenIDs(tokens []int32, blockSize, numBlocks int) [][]int32 {
+	if blockSize <= 0 && numBlocks > 0 && len(tokens)%numBlocks == 0 {
+		blockSize = len(tokens) / numBlocks
+	}
+	if blockSize <= 0 {
+		return [][]int32{tokens}
+	}
+
+	result := make([][]int32, 0, (len(tokens)+blockSize-1)/blockSize)
+	for start := 0; start < len(tokens); start += blockSize {
+		end := start + blockSize
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		result = append(result, tokens[start:end:end])
+	}
+	return result
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// benchBatch builds a batch resembling a busy vLLM worker's: stored events
+// of blocks blocks with blockSize tokens each, followed by removals.
+func benchBatch(events, blocks, blockSize int, bytesHashes bool) *EventBatch {
+	hash := func(i int) BlockHash {
+		if !bytesHashes {
+			return Int64BlockHash(int64(uint64(i) * 0x9e3779b97f4a7c15))
+		}
+		var seed [8]byte
+		binary.BigEndian.PutUint64(seed[:], uint64(i))
+		sum := sha256.Sum256(seed[:])
+		return BytesBlockHash(sum[:])
+	}
+
+	rank := 1
+	batch := &EventBatch{Timestamp: time.Unix(1700000000, 0), DataParallelRank: &rank}
+	next := 0
+	for e := 0; e < events; e++ {
+		if e%4 == 3 {
+			removed := &BlockRemovedEvent{Type: EventTypeBlockRemoved, Medium: MediumGPU}
+			for b := 0; b < blocks; b++ {
+				removed.BlockHashes = append(removed.BlockHashes, hash(next-b-1))
+			}
+			batch.Events = append(batch.Events, removed)
+			continue
+		}
+
+		parent := hash(next - 1)
+		stored := &BlockStoredEvent{
+			Type:            EventTypeBlockStored,
+			ParentBlockHash: &parent,
+			BlockSize:       blockSize,
+			Medium:          MediumGPU,
+		}
+		for b := 0; b < blocks; b++ {
+			stored.BlockHashes = append(stored.BlockHashes, hash(next))
+			tokens := make([]int32, blockSize)
+			for t := range tokens {
+				tokens[t] = int32(next*blockSize + t)
+			}
+			stored.TokenIDs = append(stored.TokenIDs, tokens)
+			next++
+		}
+		batch.Events = append(batch.Events, stored)
+	}
+	return batch
+}
+
+func BenchmarkDecodeEventBatch(b *testing.B) {
+	cases := []struct {
+		name        string
+		format      string
+		events      int
+		blocks      int
+		bytesHashes bool
+	}{
+		{name: "single_block", format: WireFormatVLLMv010, events: 1, blocks: 1},
+		{name: "prefill_32_blocks", format: WireFormatVLLMv010, events: 1, blocks: 32},
+		{name: "mixed_64_events", format: WireFormatVLLMv010, events: 64, blocks: 4},
+		{name: "bytes_hashes", format: WireFormatVLLMv011, events: 64, blocks: 4, bytesHashes: true},
+	}
+
+	for _, tc := range cases {
+		payload, err := EncodeEventBatchWithFormat(benchBatch(tc.events, tc.blocks, 16, tc.bytesHashes), tc.format)
+		if err != nil {
+			b.Fatalf("%s: failed to encode batch: %v", tc.name, err)
+		}
+
+		for _, format := range []string{WireFormatAuto, tc.format} {
+			b.Run(tc.name+"/"+format, func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(payload)))
+				for i := 0; i < b.N; i++ {
+					batch, err := DecodeEventBatchWithFormat(payload, format)
+					if err != nil {
+						b.Fatal(err)
+					}
+					batch.Release()
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeEventBatchBenchPayloads(t *testing.T) {
+	want := benchBatch(8, 4, 16, true)
+	payload, err := EncodeEventBatchWithFormat(want, WireFormatVLLMv011)
+	if err != nil {
+		t.Fatalf("failed to encode batch: %v", err)
+	}
+
+	got, err := DecodeEventBatch(payload)
+	if err != nil {
+		t.Fatalf("failed to decode batch: %v", err)
+	}
+	defer got.Release()
+
+	if len(got.Events) != len(want.Events) {
+		t.Fatalf("decoded %d events, want %d", len(got.Events), len(want.Events))
+	}
+	stored, ok := got.Events[0].(*BlockStoredEvent)
+	if !ok {
+		t.Fatalf("event 0 is %T, want *BlockStoredEvent", got.Events[0])
+	}
+	if len(stored.BlockHashes) != 4 || len(stored.TokenIDs) != 4 || len(stored.TokenIDs[3]) != 16 {
+		t.Fatalf("unexpected BlockStored shape: %d hashes, %d token blocks", len(stored.BlockHashes), len(stored.TokenIDs))
+	}
+	if stored.BlockHashes[0] != want.Events[0].(*BlockStoredEvent).BlockHashes[0] {
+		t.Errorf("block hash = %v, want %v", stored.BlockHashes[0], want.Events[0].(*BlockStoredEvent).BlockHashes[0])
+	}
+	if got.DataParallelRank == nil || *got.DataParallelRank != 1 {
+		t.Errorf("data_parallel_rank = %v, want 1", got.DataParallelRank)
+	}
+}
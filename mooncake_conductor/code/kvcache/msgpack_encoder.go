@@ -0,0 +1,178 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultEncodeWireFormat is the layout written by EncodeEventBatch
+const DefaultEncodeWireFormat = WireFormatVLLMv010
+
+// EncodeEventBatch encodes a batch as vLLM's msgspec encoder does for
+// KVEventBatch: [ts, events, data_parallel_rank], using the
+// DefaultEncodeWireFormat event layout. It is the inverse of DecodeEventBatch
+// and is intended for simulators, golden files and re-publishing relays.
+func EncodeEventBatch(batch *EventBatch) ([]byte, error) {
+	return EncodeEventBatchWithFormat(batch, DefaultEncodeWireFormat)
+}
+
+// EncodeEventBatchWithFormat encodes a batch using the named wire format.
+// An empty name or WireFormatAuto selects DefaultEncodeWireFormat.
+//
+// Encoding follows msgspec: integers use their smallest representation,
+// floats are always float64, nil optionals are written as nil and a nil
+// DataParallelRank is omitted (omit_defaults). Integer hashes are written as
+// signed values, so a hash that vLLM sent as uint64 above MaxInt64 comes back
+// as the equivalent negative int64.
+func EncodeEventBatchWithFormat(batch *EventBatch, formatName string) ([]byte, error) {
+	if formatName == "" || formatName == WireFormatAuto {
+		formatName = DefaultEncodeWireFormat
+	}
+	format, err := LookupWireFormat(formatName)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &msgpackWriter{buf: make([]byte, 0, 64+len(batch.Events)*32)}
+	if batch.DataParallelRank != nil {
+		w.writeArrayHeader(3)
+	} else {
+		w.writeArrayHeader(2)
+	}
+	w.writeFloat64(timeToUnixFloat(batch.Timestamp))
+
+	w.writeArrayHeader(len(batch.Events))
+	for i, event := range batch.Events {
+		var err error
+		switch e := event.(type) {
+		case *BlockStoredEvent:
+			err = encodeBlockStoredEvent(w, e, format.BlockStored)
+		case *BlockRemovedEvent:
+			err = encodeBlockRemovedEvent(w, e, format.BlockRemoved)
+		case *AllBlocksClearedEvent:
+			w.writeArrayHeader(1)
+			w.writeString(string(EventTypeAllCleared))
+		default:
+			err = fmt.Errorf("unsupported event type: %T", event)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode event at index %d: %w", i, err)
+		}
+	}
+
+	if batch.DataParallelRank != nil {
+		w.writeInt64(int64(*batch.DataParallelRank))
+	}
+
+	return w.buf, nil
+}
+
+func encodeBlockStoredEvent(w *msgpackWriter, e *BlockStoredEvent, layout []EventField) error {
+	w.writeArrayHeader(len(layout) + 1)
+	w.writeString(string(EventTypeBlockStored))
+
+	for _, field := range layout {
+		switch field {
+		case FieldBlockHashes:
+			writeBlockHashes(w, e.BlockHashes)
+		case FieldParentBlockHash:
+			if e.ParentBlockHash == nil {
+				w.writeNil()
+			} else {
+				writeBlockHash(w, *e.ParentBlockHash)
+			}
+		case FieldTokenIDs:
+			// vLLM sends one flat list covering all blocks
+			total := 0
+			for _, block := range e.TokenIDs {
+				total += len(block)
+			}
+			w.writeArrayHeader(total)
+			for _, block := range e.TokenIDs {
+				for _, token := range block {
+					w.writeInt64(int64(token))
+				}
+			}
+		case FieldBlockSize:
+			blockSize := e.BlockSize
+			if blockSize == 0 && len(e.TokenIDs) > 0 {
+				blockSize = len(e.TokenIDs[0])
+			}
+			w.writeInt64(int64(blockSize))
+		case FieldLoraID:
+			if e.LoraID == nil {
+				w.writeNil()
+			} else {
+				w.writeInt64(*e.LoraID)
+			}
+		case FieldMedium:
+			writeOptionalString(w, e.Medium)
+		case FieldLoraName:
+			writeOptionalString(w, e.LoraName)
+		default:
+			return fmt.Errorf("cannot encode BlockStored field %s", field)
+		}
+	}
+	return nil
+}
+
+func encodeBlockRemovedEvent(w *msgpackWriter, e *BlockRemovedEvent, layout []EventField) error {
+	w.writeArrayHeader(len(layout) + 1)
+	w.writeString(string(EventTypeBlockRemoved))
+
+	for _, field := range layout {
+		switch field {
+		case FieldBlockHashes:
+			writeBlockHashes(w, e.BlockHashes)
+		case FieldMedium:
+			writeOptionalString(w, e.Medium)
+		default:
+			return fmt.Errorf("cannot encode BlockRemoved field %s", field)
+		}
+	}
+	return nil
+}
+
+func writeBlockHashes(w *msgpackWriter, hashes []BlockHash) {
+	w.writeArrayHeader(len(hashes))
+	for _, hash := range hashes {
+		writeBlockHash(w, hash)
+	}
+}
+
+func writeBlockHash(w *msgpackWriter, hash BlockHash) {
+	if hash.IsBytes() {
+		w.writeBinary(hash.Bytes())
+		return
+	}
+	v, _ := hash.Int64()
+	w.writeInt64(v)
+}
+
+func writeOptionalString(w *msgpackWriter, s string) {
+	if s == "" {
+		w.writeNil()
+		return
+	}
+	w.writeString(s)
+}
+
+// timeToUnixFloat converts a timestamp back to float seconds. It round-trips
+// timestamps produced by readTimestamp exactly.
+func timeToUnixFloat(t time.Time) float64 {
+	return float64(t.Unix()) + float64(t.Nanosecond())/1e9
+}
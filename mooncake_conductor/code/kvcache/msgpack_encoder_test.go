@@ -0,0 +1,192 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Golden payloads, spelled out as msgspec.msgpack.Encoder writes vLLM's
+// array_like, tagged KVEventBatch structs: smallest integer encodings,
+// float64 timestamps, nil for unset optionals and the trailing
+// data_parallel_rank omitted when it is None.
+var (
+	// vLLM 0.10:
+	//   KVEventBatch(ts=1700000000.5, data_parallel_rank=1, events=[
+	//     BlockStored(block_hashes=[0x123456789, -2], parent_block_hash=300,
+	//                 token_ids=[1, 2, 3, 4], block_size=2, lora_id=None, medium="GPU"),
+	//     BlockRemoved(block_hashes=[-128], medium="GPU"),
+	//     AllBlocksCleared()])
+	goldenVLLMv010 = []byte("" +
+		"\x93" + // [ts, events, data_parallel_rank]
+		"\xcb\x41\xd9\x54\xfc\x40\x20\x00\x00" + // 1700000000.5
+		"\x93" +
+		"\x97\xabBlockStored" +
+		"\x92\xcf\x00\x00\x00\x01\x23\x45\x67\x89\xfe" + // uint64, negative fixint
+		"\xcd\x01\x2c" + // parent 300 as uint16
+		"\x94\x01\x02\x03\x04" +
+		"\x02" + // block_size
+		"\xc0" + // lora_id None
+		"\xa3GPU" +
+		"\x93\xacBlockRemoved\x91\xd0\x80\xa3GPU" + // -128 as int8
+		"\x91\xb0AllBlocksCleared" +
+		"\x01")
+
+	// vLLM 0.11, bytes hashes and a LoRA adapter, no rank:
+	//   KVEventBatch(ts=1700000000.5, events=[
+	//     BlockStored(block_hashes=[b"\xde\xad\xbe\xef"], parent_block_hash=None,
+	//                 token_ids=[5, 6], block_size=2, lora_id=3, medium=None,
+	//                 lora_name="adapter")])
+	goldenVLLMv011 = []byte("" +
+		"\x92" +
+		"\xcb\x41\xd9\x54\xfc\x40\x20\x00\x00" +
+		"\x91" +
+		"\x98\xabBlockStored" +
+		"\x91\xc4\x04\xde\xad\xbe\xef" + // bin8
+		"\xc0" +
+		"\x92\x05\x06" +
+		"\x02" +
+		"\x03" +
+		"\xc0" +
+		"\xa7adapter")
+)
+
+func TestEncodeEventBatchGolden(t *testing.T) {
+	ts := time.Unix(1700000000, 500000000).UTC()
+	rank := 1
+	parent := Int64BlockHash(300)
+	loraID := int64(3)
+
+	cases := []struct {
+		name   string
+		format string
+		batch  *EventBatch
+		want   []byte
+	}{
+		{
+			name:   "vllm-0.10",
+			format: WireFormatVLLMv010,
+			want:   goldenVLLMv010,
+			batch: &EventBatch{
+				Timestamp:        ts,
+				DataParallelRank: &rank,
+				Events: []KVEvent{
+					&BlockStoredEvent{
+						Type:            EventTypeBlockStored,
+						Timestamp:       ts,
+						BlockHashes:     []BlockHash{Int64BlockHash(0x123456789), Int64BlockHash(-2)},
+						ParentBlockHash: &parent,
+						TokenIDs:        [][]int32{{1, 2}, {3, 4}},
+						BlockSize:       2,
+						Medium:          MediumGPU,
+					},
+					&BlockRemovedEvent{
+						Type:        EventTypeBlockRemoved,
+						Timestamp:   ts,
+						BlockHashes: []BlockHash{Int64BlockHash(-128)},
+						Medium:      MediumGPU,
+					},
+					&AllBlocksClearedEvent{Type: EventTypeAllCleared, Timestamp: ts},
+				},
+			},
+		},
+		{
+			name:   "vllm-0.11",
+			format: WireFormatVLLMv011,
+			want:   goldenVLLMv011,
+			batch: &EventBatch{
+				Timestamp: ts,
+				Events: []KVEvent{
+					&BlockStoredEvent{
+						Type:        EventTypeBlockStored,
+						Timestamp:   ts,
+						BlockHashes: []BlockHash{BytesBlockHash([]byte{0xde, 0xad, 0xbe, 0xef})},
+						TokenIDs:    [][]int32{{5, 6}},
+						BlockSize:   2,
+						LoraID:      &loraID,
+						LoraName:    "adapter",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := EncodeEventBatchWithFormat(tc.batch, tc.format)
+			if err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Fatalf("encoded batch differs from golden:\n got %x\nwant %x", got, tc.want)
+			}
+
+			decoded, err := DecodeEventBatchWithFormat(tc.want, tc.format)
+			if err != nil {
+				t.Fatalf("failed to decode golden: %v", err)
+			}
+			defer decoded.Release()
+			if !decoded.Timestamp.Equal(tc.batch.Timestamp) {
+				t.Errorf("timestamp = %v, want %v", decoded.Timestamp, tc.batch.Timestamp)
+			}
+			if !reflect.DeepEqual(decoded.DataParallelRank, tc.batch.DataParallelRank) {
+				t.Errorf("rank = %v, want %v", decoded.DataParallelRank, tc.batch.DataParallelRank)
+			}
+			for i, event := range decoded.Events {
+				if !reflect.DeepEqual(event, tc.batch.Events[i]) {
+					t.Errorf("event %d = %#v, want %#v", i, event, tc.batch.Events[i])
+				}
+			}
+		})
+	}
+}
+
+// TestEventBatchRoundTrip decodes payloads and encodes them again, which
+// must reproduce the input byte for byte.
+func TestEventBatchRoundTrip(t *testing.T) {
+	payloads := map[string][]byte{
+		WireFormatVLLMv010: goldenVLLMv010,
+		WireFormatVLLMv011: goldenVLLMv011,
+	}
+	bench, err := EncodeEventBatchWithFormat(benchBatch(16, 4, 16, true), WireFormatVLLMv011)
+	if err != nil {
+		t.Fatalf("failed to encode batch: %v", err)
+	}
+
+	for format, payload := range payloads {
+		roundTrip(t, format, payload)
+	}
+	roundTrip(t, WireFormatVLLMv011, bench)
+}
+
+func roundTrip(t *testing.T, format string, payload []byte) {
+	t.Helper()
+	batch, err := DecodeEventBatchWithFormat(payload, format)
+	if err != nil {
+		t.Fatalf("%s: failed to decode: %v", format, err)
+	}
+	defer batch.Release()
+
+	got, err := EncodeEventBatchWithFormat(batch, format)
+	if err != nil {
+		t.Fatalf("%s: failed to encode: %v", format, err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("%s: round trip differs:\n got %x\nwant %x", format, got, payload)
+	}
+}
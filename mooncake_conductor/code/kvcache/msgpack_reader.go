@@ -0,0 +1,460 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// MessagePack format bytes used by the reader.
+// See https://github.com/msgpack/msgpack/blob/master/spec.md
+const (
+	mpNil      = 0xc0
+	mpFalse    = 0xc2
+	mpTrue     = 0xc3
+	mpBin8     = 0xc4
+	mpBin16    = 0xc5
+	mpBin32    = 0xc6
+	mpExt8     = 0xc7
+	mpExt16    = 0xc8
+	mpExt32    = 0xc9
+	mpFloat32  = 0xca
+	mpFloat64  = 0xcb
+	mpUint8    = 0xcc
+	mpUint16   = 0xcd
+	mpUint32   = 0xce
+	mpUint64   = 0xcf
+	mpInt8     = 0xd0
+	mpInt16    = 0xd1
+	mpInt32    = 0xd2
+	mpInt64    = 0xd3
+	mpFixExt1  = 0xd4
+	mpFixExt16 = 0xd8
+	mpStr8     = 0xd9
+	mpStr16    = 0xda
+	mpStr32    = 0xdb
+	mpArray16  = 0xdc
+	mpArray32  = 0xdd
+	mpMap16    = 0xde
+	mpMap32    = 0xdf
+)
+
+var errShortBuffer = errors.New("unexpected end of msgpack data")
+
+// maxSkipDepth bounds the nesting skip descends into, so a hostile payload
+// of nested arrays cannot exhaust the stack.
+const maxSkipDepth = 64
+
+// msgpackReader walks a MessagePack buffer in place without building an
+// intermediate []interface{} tree. Strings and binaries are returned as
+// sub-slices of the input and are only valid while the input is.
+type msgpackReader struct {
+	buf []byte
+	pos int
+}
+
+var readerPool = sync.Pool{
+	New: func() interface{} { return new(msgpackReader) },
+}
+
+func getReader(data []byte) *msgpackReader {
+	r := readerPool.Get().(*msgpackReader)
+	r.buf = data
+	r.pos = 0
+	return r
+}
+
+func putReader(r *msgpackReader) {
+	r.buf = nil
+	r.pos = 0
+	readerPool.Put(r)
+}
+
+func (r *msgpackReader) remaining() int {
+	return len(r.buf) - r.pos
+}
+
+func (r *msgpackReader) peek() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errShortBuffer
+	}
+	return r.buf[r.pos], nil
+}
+
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || r.remaining() < n {
+		return nil, errShortBuffer
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *msgpackReader) readByte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errShortBuffer
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *msgpackReader) readUint(n int) (uint64, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+// isNil reports whether the next value is nil without consuming it.
+func (r *msgpackReader) isNil() bool {
+	c, err := r.peek()
+	return err == nil && c == mpNil
+}
+
+// readNil consumes a nil value.
+func (r *msgpackReader) readNil() error {
+	c, err := r.readByte()
+	if err != nil {
+		return err
+	}
+	if c != mpNil {
+		return fmt.Errorf("expected nil, got 0x%02x", c)
+	}
+	return nil
+}
+
+// readArrayHeader returns the number of elements in the next array.
+func (r *msgpackReader) readArrayHeader() (int, error) {
+	c, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	switch {
+	case c >= 0x90 && c <= 0x9f:
+		n = uint64(c & 0x0f)
+	case c == mpArray16:
+		n, err = r.readUint(2)
+	case c == mpArray32:
+		n, err = r.readUint(4)
+	default:
+		return 0, fmt.Errorf("expected array, got 0x%02x", c)
+	}
+	if err != nil {
+		return 0, err
+	}
+	// Every element occupies at least one byte
+	if n > uint64(r.remaining()) {
+		return 0, errShortBuffer
+	}
+	return int(n), nil
+}
+
+// readInt64 reads any integer encoding. Unsigned values above MaxInt64 keep
+// their bit pattern, which matches how vLLM hashes wrap into 64 bits.
+func (r *msgpackReader) readInt64() (int64, error) {
+	c, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	}
+
+	var u uint64
+	switch c {
+	case mpUint8:
+		u, err = r.readUint(1)
+	case mpUint16:
+		u, err = r.readUint(2)
+	case mpUint32:
+		u, err = r.readUint(4)
+	case mpUint64:
+		u, err = r.readUint(8)
+	case mpInt8:
+		u, err = r.readUint(1)
+		return int64(int8(u)), err
+	case mpInt16:
+		u, err = r.readUint(2)
+		return int64(int16(u)), err
+	case mpInt32:
+		u, err = r.readUint(4)
+		return int64(int32(u)), err
+	case mpInt64:
+		u, err = r.readUint(8)
+	case mpFloat32, mpFloat64:
+		r.pos--
+		f, err := r.readFloat64()
+		return int64(f), err
+	default:
+		return 0, fmt.Errorf("expected integer, got 0x%02x", c)
+	}
+	return int64(u), err
+}
+
+// readFloat64 reads a float or integer as float64.
+func (r *msgpackReader) readFloat64() (float64, error) {
+	c, err := r.peek()
+	if err != nil {
+		return 0, err
+	}
+	switch c {
+	case mpFloat32:
+		r.pos++
+		u, err := r.readUint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case mpFloat64:
+		r.pos++
+		u, err := r.readUint(8)
+		return math.Float64frombits(u), err
+	default:
+		n, err := r.readInt64()
+		return float64(n), err
+	}
+}
+
+// readStringBytes reads a str value and returns it without copying.
+func (r *msgpackReader) readStringBytes() ([]byte, error) {
+	c, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	var n uint64
+	switch {
+	case c >= 0xa0 && c <= 0xbf:
+		n = uint64(c & 0x1f)
+	case c == mpStr8:
+		n, err = r.readUint(1)
+	case c == mpStr16:
+		n, err = r.readUint(2)
+	case c == mpStr32:
+		n, err = r.readUint(4)
+	default:
+		return nil, fmt.Errorf("expected string, got 0x%02x", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.next(int(n))
+}
+
+// readBinary reads a bin value and returns it without copying.
+func (r *msgpackReader) readBinary() ([]byte, error) {
+	c, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	var n uint64
+	switch c {
+	case mpBin8:
+		n, err = r.readUint(1)
+	case mpBin16:
+		n, err = r.readUint(2)
+	case mpBin32:
+		n, err = r.readUint(4)
+	default:
+		return nil, fmt.Errorf("expected binary, got 0x%02x", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.next(int(n))
+}
+
+// readTimestamp reads a Unix timestamp encoded as float seconds or integer seconds.
+func (r *msgpackReader) readTimestamp() (time.Time, error) {
+	f, err := r.readFloat64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Round to the nearest nanosecond so timeToUnixFloat restores f exactly
+	sec := math.Floor(f)
+	nsec := math.Round((f - sec) * 1e9)
+	return time.Unix(int64(sec), int64(nsec)).UTC(), nil
+}
+
+// readOptionalInt64 reads an integer or nil.
+func (r *msgpackReader) readOptionalInt64() (*int64, error) {
+	if r.isNil() {
+		return nil, r.readNil()
+	}
+	v, err := r.readInt64()
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// readOptionalString reads a string or nil. Well-known storage tiers are
+// returned without allocating.
+func (r *msgpackReader) readOptionalString() (string, error) {
+	if r.isNil() {
+		return "", r.readNil()
+	}
+	b, err := r.readStringBytes()
+	if err != nil {
+		return "", err
+	}
+	switch string(b) {
+	case MediumGPU:
+		return MediumGPU, nil
+	case MediumCPU:
+		return MediumCPU, nil
+	case MooncakeTierMemory:
+		return MooncakeTierMemory, nil
+	case MooncakeTierDisk:
+		return MooncakeTierDisk, nil
+	}
+	return string(b), nil
+}
+
+// readInt32Array reads an array of integers into an exactly sized slice.
+func (r *msgpackReader) readInt32Array() ([]int32, error) {
+	n, err := r.readArrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]int32, n)
+	for i := range result {
+		v, err := r.readInt64()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse element at index %d: %w", i, err)
+		}
+		result[i] = int32(v)
+	}
+	return result, nil
+}
+
+// skip consumes the next value of any type.
+func (r *msgpackReader) skip() error {
+	return r.skipValue(0)
+}
+
+// skipValue consumes one value nested depth containers deep.
+func (r *msgpackReader) skipValue(depth int) error {
+	c, err := r.readByte()
+	if err != nil {
+		return err
+	}
+
+	var n uint64
+	switch {
+	case c <= 0x7f, c >= 0xe0, c == mpNil, c == mpFalse, c == mpTrue:
+		return nil
+	case c >= 0x80 && c <= 0x8f:
+		return r.skipItems(2*int(c&0x0f), depth)
+	case c >= 0x90 && c <= 0x9f:
+		return r.skipItems(int(c&0x0f), depth)
+	case c >= 0xa0 && c <= 0xbf:
+		_, err = r.next(int(c & 0x1f))
+		return err
+	}
+
+	switch c {
+	case mpUint8, mpInt8:
+		_, err = r.next(1)
+	case mpUint16, mpInt16:
+		_, err = r.next(2)
+	case mpUint32, mpInt32, mpFloat32:
+		_, err = r.next(4)
+	case mpUint64, mpInt64, mpFloat64:
+		_, err = r.next(8)
+	case mpBin8, mpStr8:
+		if n, err = r.readUint(1); err == nil {
+			_, err = r.next(int(n))
+		}
+	case mpBin16, mpStr16:
+		if n, err = r.readUint(2); err == nil {
+			_, err = r.next(int(n))
+		}
+	case mpBin32, mpStr32:
+		if n, err = r.readUint(4); err == nil {
+			_, err = r.next(int(n))
+		}
+	case mpExt8:
+		if n, err = r.readUint(1); err == nil {
+			_, err = r.next(int(n) + 1)
+		}
+	case mpExt16:
+		if n, err = r.readUint(2); err == nil {
+			_, err = r.next(int(n) + 1)
+		}
+	case mpExt32:
+		if n, err = r.readUint(4); err == nil {
+			_, err = r.next(int(n) + 1)
+		}
+	case mpArray16:
+		if n, err = r.readUint(2); err == nil {
+			err = r.skipItems(int(n), depth)
+		}
+	case mpArray32:
+		if n, err = r.readUint(4); err == nil {
+			err = r.skipItems(int(n), depth)
+		}
+	case mpMap16:
+		if n, err = r.readUint(2); err == nil {
+			err = r.skipItems(2*int(n), depth)
+		}
+	case mpMap32:
+		if n, err = r.readUint(4); err == nil {
+			err = r.skipItems(2*int(n), depth)
+		}
+	default:
+		if c >= mpFixExt1 && c <= mpFixExt16 {
+			// fixext 1/2/4/8/16: type byte plus 2^(c-0xd4) data bytes
+			_, err = r.next(1 + 1<<(c-mpFixExt1))
+		} else {
+			err = fmt.Errorf("unsupported msgpack format 0x%02x", c)
+		}
+	}
+	return err
+}
+
+// skipN consumes n consecutive values.
+func (r *msgpackReader) skipN(n int) error {
+	return r.skipItems(n, 0)
+}
+
+// skipItems consumes the n values of a container found depth levels deep.
+func (r *msgpackReader) skipItems(n, depth int) error {
+	if depth >= maxSkipDepth {
+		return fmt.Errorf("msgpack nesting exceeds %d levels", maxSkipDepth)
+	}
+	for i := 0; i < n; i++ {
+		if err := r.skipValue(depth + 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
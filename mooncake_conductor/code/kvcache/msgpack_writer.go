@@ -0,0 +1,122 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// msgpackWriter appends MessagePack values to a buffer using the smallest
+// encoding for each value, matching what msgspec emits on the Python side.
+type msgpackWriter struct {
+	buf []byte
+}
+
+func (w *msgpackWriter) writeNil() {
+	w.buf = append(w.buf, mpNil)
+}
+
+func (w *msgpackWriter) writeArrayHeader(n int) {
+	switch {
+	case n <= 0x0f:
+		w.buf = append(w.buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		w.buf = append(w.buf, mpArray16)
+		w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(n))
+	default:
+		w.buf = append(w.buf, mpArray32)
+		w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(n))
+	}
+}
+
+// writeInt64 encodes non-negative values as unsigned and negative values as
+// signed integers.
+func (w *msgpackWriter) writeInt64(v int64) {
+	if v >= 0 {
+		w.writeUint64(uint64(v))
+		return
+	}
+	switch {
+	case v >= -32:
+		w.buf = append(w.buf, byte(int8(v)))
+	case v >= math.MinInt8:
+		w.buf = append(w.buf, mpInt8, byte(int8(v)))
+	case v >= math.MinInt16:
+		w.buf = append(w.buf, mpInt16)
+		w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(v))
+	case v >= math.MinInt32:
+		w.buf = append(w.buf, mpInt32)
+		w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(v))
+	default:
+		w.buf = append(w.buf, mpInt64)
+		w.buf = binary.BigEndian.AppendUint64(w.buf, uint64(v))
+	}
+}
+
+func (w *msgpackWriter) writeUint64(v uint64) {
+	switch {
+	case v <= 0x7f:
+		w.buf = append(w.buf, byte(v))
+	case v <= math.MaxUint8:
+		w.buf = append(w.buf, mpUint8, byte(v))
+	case v <= math.MaxUint16:
+		w.buf = append(w.buf, mpUint16)
+		w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(v))
+	case v <= math.MaxUint32:
+		w.buf = append(w.buf, mpUint32)
+		w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(v))
+	default:
+		w.buf = append(w.buf, mpUint64)
+		w.buf = binary.BigEndian.AppendUint64(w.buf, v)
+	}
+}
+
+func (w *msgpackWriter) writeFloat64(f float64) {
+	w.buf = append(w.buf, mpFloat64)
+	w.buf = binary.BigEndian.AppendUint64(w.buf, math.Float64bits(f))
+}
+
+func (w *msgpackWriter) writeString(s string) {
+	n := len(s)
+	switch {
+	case n <= 31:
+		w.buf = append(w.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		w.buf = append(w.buf, mpStr8, byte(n))
+	case n <= math.MaxUint16:
+		w.buf = append(w.buf, mpStr16)
+		w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(n))
+	default:
+		w.buf = append(w.buf, mpStr32)
+		w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(n))
+	}
+	w.buf = append(w.buf, s...)
+}
+
+func (w *msgpackWriter) writeBinary(b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		w.buf = append(w.buf, mpBin8, byte(n))
+	case n <= math.MaxUint16:
+		w.buf = append(w.buf, mpBin16)
+		w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(n))
+	default:
+		w.buf = append(w.buf, mpBin32)
+		w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(n))
+	}
+	w.buf = append(w.buf, b...)
+}
@@ -0,0 +1,52 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import "sync"
+
+// Reactor waits on the sockets of many clients from a single goroutine and
+// wakes a client only once one of its sockets is ready. Transports that
+// poll sockets (libzmq) use the reactor set in ZMQClientConfig.Reactor;
+// the others wait on channels and need none.
+type Reactor interface {
+	// Close stops the reactor. Clients using it must be stopped first.
+	Close() error
+}
+
+var (
+	defaultReactorMu sync.RWMutex
+	defaultReactor   func() (Reactor, error)
+)
+
+// SetDefaultReactor sets the factory used by NewReactor. Built with the
+// zmq tag, the libzmq transport registers its reactor.
+func SetDefaultReactor(factory func() (Reactor, error)) {
+	defaultReactorMu.Lock()
+	defer defaultReactorMu.Unlock()
+	defaultReactor = factory
+}
+
+// NewReactor starts a reactor for the default transport. It returns nil
+// without an error if the default transport needs none.
+func NewReactor() (Reactor, error) {
+	defaultReactorMu.RLock()
+	factory := defaultReactor
+	defaultReactorMu.RUnlock()
+
+	if factory == nil {
+		return nil, nil
+	}
+	return factory()
+}
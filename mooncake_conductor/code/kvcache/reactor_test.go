@@ -0,0 +1,104 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// wakeCounter counts the receives of the transport it wraps that returned
+// nothing, i.e. how often an idle client woke up. It hides the Notifier of
+// the wrapped transport, so its client polls every PollTimeout.
+type wakeCounter struct {
+	Transport
+	wakeups *atomic.Int64
+}
+
+func (t wakeCounter) Recv(timeout time.Duration) ([][]byte, error) {
+	frames, err := t.Transport.Recv(timeout)
+	if frames == nil && err == nil {
+		t.wakeups.Add(1)
+	}
+	return frames, err
+}
+
+// notifyingWakeCounter is a wakeCounter that passes Notify through.
+type notifyingWakeCounter struct {
+	wakeCounter
+}
+
+func (t notifyingWakeCounter) Notify() (<-chan struct{}, func()) {
+	return t.Transport.(Notifier).Notify()
+}
+
+// benchmarkIdle runs services idle clients for b.N milliseconds and
+// reports how often each woke up per second. newTransport returns the
+// transport of a client and may set its endpoints.
+func benchmarkIdle(b *testing.B, services int, reactor Reactor, poll bool, newTransport func(config *ZMQClientConfig) Transport) {
+	var wakeups atomic.Int64
+	clients := make([]*StaticZMQClient, services)
+	for i := range clients {
+		config := DefaultZMQClientConfig(fmt.Sprintf("svc-%d", i), "127.0.0.1", "")
+		config.RouterPort = 0
+		config.PollTimeout = 10 * time.Millisecond
+		config.Reactor = reactor
+
+		var transport Transport = wakeCounter{newTransport(config), &wakeups}
+		if !poll {
+			transport = notifyingWakeCounter{transport.(wakeCounter)}
+		}
+		clients[i] = NewStaticZMQClient(config, &eventRecorder{}, nil)
+		clients[i].SetTransport(transport)
+		if err := clients[i].Start(); err != nil {
+			b.Fatalf("failed to start client: %v", err)
+		}
+		defer clients[i].Stop()
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for _, client := range clients {
+		for client.Status().State != ConnectionStateConnected {
+			if time.Now().After(deadline) {
+				b.Fatalf("%s did not connect", client.config.PodKey)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	wakeups.Store(0)
+	b.ResetTimer()
+	start := time.Now()
+	time.Sleep(time.Duration(b.N) * time.Millisecond)
+	elapsed := time.Since(start)
+	b.StopTimer()
+	b.ReportMetric(float64(wakeups.Load())/float64(services)/elapsed.Seconds(), "wakeups/s/service")
+}
+
+// BenchmarkReactorIdle compares idle clients that park on their transport
+// with clients that poll it, over MemoryTransport. The libzmq reactor is
+// benchmarked by BenchmarkZMQReactorIdle.
+func BenchmarkReactorIdle(b *testing.B) {
+	const services = 200
+	for _, mode := range []string{"notify", "poll"} {
+		b.Run(fmt.Sprintf("%s/%d_services", mode, services), func(b *testing.B) {
+			benchmarkIdle(b, services, nil, mode == "poll", func(*ZMQClientConfig) Transport {
+				return NewMemoryTransport(16, 1)
+			})
+		})
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTransportClosed is returned by a Transport that is not connected.
+var ErrTransportClosed = errors.New("transport is closed")
+
+// Transport carries a publisher's event stream and replay responses to a
+// StaticZMQClient. A Transport is used by one goroutine at a time; it may be
+// connected again after Close.
+type Transport interface {
+	// Connect subscribes to the publisher and, if the config has a replay
+	// endpoint, opens the replay channel.
+	Connect() error
+
+	// Recv returns the next published message as [topic, seq, payload].
+	// It returns nil without an error if nothing arrives within timeout.
+	Recv(timeout time.Duration) ([][]byte, error)
+
+	// RequestReplay asks the publisher to resend its buffered batches from
+	// fromSeq on. Responses left over from an earlier request are discarded.
+	RequestReplay(fromSeq int64) error
+
+	// RecvReplay returns the next replay response as [seq, payload]. The
+	// stream ends with a response whose seq is -1. Unlike Recv, a timeout
+	// is an error.
+	RecvReplay(timeout time.Duration) ([][]byte, error)
+
+	// PeerStatus reports the connection to the publisher's event stream as
+	// last observed on the socket. Connect only starts connecting, so a
+	// reachable publisher shows up as connected some time after it returns.
+	PeerStatus() PeerStatus
+
+	// Close releases the connection.
+	Close() error
+}
+
+// Notifier is implemented by transports that can tell when Recv has
+// something to return, so an idle client can sleep instead of polling.
+type Notifier interface {
+	// Notify returns a channel that becomes readable once Recv would not
+	// block: a message, an error or a peer status change is pending. It is
+	// readable at once if that is already the case. Until then the
+	// transport is not used by the caller; cancel ends the wait early and
+	// returns once the transport may be used again. A nil channel means
+	// the transport cannot notify and must be polled.
+	Notify() (ready <-chan struct{}, cancel func())
+}
+
+// readyNow is a Notify channel for a transport that is already ready
+var readyNow = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// PeerStatus is a Transport's view of its connection to the publisher.
+type PeerStatus struct {
+	State   ConnectionState // Connecting, connected or disconnected; never stale
+	Retries int             // Failed connection attempts since the publisher was last reached
+}
+
+// subscriptionTopics returns the topic prefixes a SUB socket subscribes to.
+func subscriptionTopics(config *ZMQClientConfig) []string {
+	if len(config.Topics) == 0 {
+		return []string{""}
+	}
+	return config.Topics
+}
+
+// TransportFactory creates the Transport of a client from its configuration.
+type TransportFactory func(config *ZMQClientConfig) (Transport, error)
+
+var (
+	defaultTransportMu sync.RWMutex
+	defaultTransport   TransportFactory
+)
+
+// SetDefaultTransport sets the factory used by clients that were not given
+// a Transport. Built with the zmq tag, the libzmq transport registers
+// itself; otherwise the pure-Go ZMTP transport does.
+func SetDefaultTransport(factory TransportFactory) {
+	defaultTransportMu.Lock()
+	defer defaultTransportMu.Unlock()
+	defaultTransport = factory
+}
+
+// NewTransport creates a Transport with the default factory.
+func NewTransport(config *ZMQClientConfig) (Transport, error) {
+	defaultTransportMu.RLock()
+	factory := defaultTransport
+	defaultTransportMu.RUnlock()
+
+	if factory == nil {
+		return nil, errors.New("no transport registered")
+	}
+	return factory(config)
+}
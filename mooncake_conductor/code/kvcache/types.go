@@ -16,7 +16,7 @@ package kvcache
 
 import (
 	"fmt"
-	"net"
+	"slices"
 	"time"
 )
 
@@ -25,18 +25,156 @@ type EventHandler interface {
 	HandleEvent(event KVEvent) error
 }
 
+// LivenessHandler is optionally implemented by an EventHandler that wants
+// to know when a publisher's stream goes stale (no message within
+// ZMQClientConfig.StaleTimeout) and when it recovers. HandleStale is called
+// from the reader, not the handler worker, so it must not handle events
+// itself; returning true queues an AllBlocksClearedEvent behind the batches
+// already received instead.
+type LivenessHandler interface {
+	HandleStale(stale bool) (clear bool)
+}
+
 // ZMQClientConfig contains configuration for the ZMQ client
 type ZMQClientConfig struct {
 	PodKey         string
-	PodIP          string
+	PodIP          string // IP address or hostname, unless PubEndpoint is set
 	ModelName      string
 	PubPort        int
-	RouterPort     int
+	RouterPort     int // 0 if the publisher has no replay endpoint
 	PollTimeout    time.Duration
 	ReplayTimeout  time.Duration
 	ReconnectDelay time.Duration
+	WireFormat     string // vLLM event layout, see RegisterWireFormat ("" auto-detects)
+	DPRank         int    // Data parallel rank served by PubPort/RouterPort
+
+	// PubEndpoint and ReplayEndpoint, if set, replace PodIP and the ports
+	// with endpoint URLs: tcp://host:port, ipc:///path or inproc://name
+	// (see ParseEndpoint). With PubEndpoint set, the publisher has a replay
+	// endpoint only if ReplayEndpoint is set.
+	PubEndpoint    string
+	ReplayEndpoint string
+
+	// ResolveInterval is how often tcp hostnames are resolved again; the
+	// client reconnects when their addresses changed. Zero disables it.
+	ResolveInterval time.Duration
+
+	// Topics lists the topic prefixes to subscribe to; empty subscribes to
+	// every topic. Publishers filter by prefix, so "kv" also matches "kv-dp0".
+	// Replayed batches carry no topic and could not be filtered, so replay
+	// is disabled while Topics is set and gaps go straight to GapPolicy.
+	Topics []string
+
+	// Curve, if set, encrypts and authenticates both sockets with CURVE
+	Curve *CurveKeys
+
+	// ZMTP heartbeats: a PING is sent every HeartbeatInterval and the
+	// connection is re-established when nothing arrives within
+	// HeartbeatTimeout. Zero disables heartbeats.
+	HeartbeatInterval time.Duration
+	HeartbeatTimeout  time.Duration
+
+	// StaleTimeout marks the stream stale when no message arrived for that
+	// long, which a silently dead publisher cannot be told apart from
+	// otherwise. Zero disables the watchdog.
+	StaleTimeout time.Duration
+
+	// Reconnect backoff: the delay starts at ReconnectDelay and grows by
+	// ReconnectBackoffFactor after each attempt, up to MaxReconnectDelay. It
+	// starts over once a connection delivers a message or reaches the peer.
+	MaxReconnectDelay      time.Duration
+	ReconnectBackoffFactor float64
+
+	// Gap recovery: gaps up to MaxGapReplay batches are replayed; gaps the
+	// publisher can no longer replay are handled according to GapPolicy.
+	MaxGapReplay int
+	GapPolicy    GapPolicy
+
+	// Handler queue: received batches wait in a queue of QueueSize batches
+	// (EventChannelBufferSize if zero) for the handler worker, so a slow
+	// handler does not stall the socket. OverflowPolicy decides what happens
+	// when the queue is full.
+	QueueSize      int
+	OverflowPolicy OverflowPolicy
+
+	// Reactor, if set, waits on the client's sockets together with those
+	// of other clients, so an idle client is not woken every PollTimeout.
+	Reactor Reactor
 }
 
+// ClientStatus is a snapshot of a client's connection state
+type ClientStatus struct {
+	Service           string
+	State             ConnectionState
+	ConnectRetries    int       // Failed attempts to reach the publisher since it was last reached
+	LastSeq           int64     // Last applied sequence number, -1 if none
+	HandledSeq        int64     // Last sequence number handed to the handler, -1 if none
+	Duplicates        uint64    // Batches skipped because their sequence was already applied
+	PublisherRestarts int       // Publisher restarts detected since start
+	ReconnectAttempts int       // Attempts since a connection last delivered a message or a connected peer
+	LastError         string    // Why the connection was last lost or could not be made
+	NextRetry         time.Time // When the next reconnect is attempted; zero while connected
+	Stale             bool      // No message arrived within StaleTimeout
+	LastMessageAt     time.Time // When the last batch was received
+
+	// Handler queue metrics
+	QueueDepth     int    // Batches waiting for the handler
+	QueueCapacity  int    // Maximum number of waiting batches
+	QueueHighWater int    // Largest depth seen since start
+	QueueDropped   uint64 // Batches discarded by OverflowDropOldest
+	QueuePauses    uint64 // Times reading was paused by OverflowPauseReplay
+}
+
+// ConnectionState is the state of a client's connection to its publisher
+type ConnectionState string
+
+const (
+	// ConnectionStateConnecting means the socket is open but the publisher
+	// has not been reached yet; ZMQ keeps retrying in the background
+	ConnectionStateConnecting ConnectionState = "connecting"
+
+	// ConnectionStateConnected means the handshake with the publisher succeeded
+	ConnectionStateConnected ConnectionState = "connected"
+
+	// ConnectionStateDisconnected means the connection was lost or the
+	// socket is closed until the next reconnect attempt
+	ConnectionStateDisconnected ConnectionState = "disconnected"
+
+	// ConnectionStateStale means the publisher is connected but sent
+	// nothing within StaleTimeout
+	ConnectionStateStale ConnectionState = "stale"
+)
+
+// GapPolicy decides what happens when missed batches cannot be replayed
+type GapPolicy string
+
+const (
+	// GapPolicyPurge clears the service's index entries with a synthesized
+	// AllBlocksClearedEvent, since missed removals may have left stale blocks
+	GapPolicyPurge GapPolicy = "purge"
+
+	// GapPolicyIgnore only logs the gap and keeps the (possibly stale) entries
+	GapPolicyIgnore GapPolicy = "ignore"
+)
+
+// OverflowPolicy decides what happens when the handler queue is full
+type OverflowPolicy string
+
+const (
+	// OverflowBlock stops reading until the handler catches up; the
+	// publisher's high-water mark may then drop messages upstream
+	OverflowBlock OverflowPolicy = "block"
+
+	// OverflowDropOldest discards the oldest queued batch to make room,
+	// losing its events; the loss is handled like a gap that cannot be
+	// replayed, see GapPolicy. Synthesized clears are never discarded.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+
+	// OverflowPauseReplay discards new batches until the queue is half
+	// empty, then replays them from the publisher like any other gap
+	OverflowPauseReplay OverflowPolicy = "pause-replay"
+)
+
 // Constants for ZMQ client configuration
 const (
 	// Default ZMQ ports
@@ -49,9 +187,25 @@ const (
 	DefaultReconnectInterval = 1 * time.Second
 	MaxReconnectInterval     = 30 * time.Second
 	ReconnectBackoffFactor   = 2.0
+	ReconnectJitter          = 0.2 // Each delay varies by up to ±20%
+	DefaultHeartbeatInterval = 5 * time.Second
+	DefaultHeartbeatTimeout  = 15 * time.Second
+	DefaultResolveInterval   = 30 * time.Second
 
 	// Buffer sizes
-	EventChannelBufferSize = 1000
+	EventChannelBufferSize    = 1000
+	DefaultDeadLetterCapacity = 1024
+	// Size at which a dead letter spill file is rotated
+	DefaultDeadLetterSpillBytes = 64 << 20
+
+	// Gap recovery, matching vLLM's default replay buffer_steps
+	DefaultMaxGapReplay = 10000
+	DefaultGapPolicy    = GapPolicyPurge
+
+	DefaultOverflowPolicy = OverflowBlock
+
+	// How often the handled sequence is checkpointed while batches arrive
+	DefaultCheckpointInterval = 1 * time.Second
 )
 
 // DefaultZMQClientConfig returns a default configuration
@@ -65,31 +219,128 @@ func DefaultZMQClientConfig(podKey, podIP, modelName string) *ZMQClientConfig {
 		PollTimeout:    DefaultPollTimeout,
 		ReplayTimeout:  DefaultReplayTimeout,
 		ReconnectDelay: DefaultReconnectInterval,
+		MaxGapReplay:   DefaultMaxGapReplay,
+		GapPolicy:      DefaultGapPolicy,
+		QueueSize:      EventChannelBufferSize,
+		OverflowPolicy: DefaultOverflowPolicy,
+
+		MaxReconnectDelay:      MaxReconnectInterval,
+		ReconnectBackoffFactor: ReconnectBackoffFactor,
+		HeartbeatInterval:      DefaultHeartbeatInterval,
+		HeartbeatTimeout:       DefaultHeartbeatTimeout,
+		ResolveInterval:        DefaultResolveInterval,
+	}
+}
+
+// pubEndpoint returns the publisher URL, built from PodIP and PubPort
+// unless PubEndpoint is set.
+func (c *ZMQClientConfig) pubEndpoint() string {
+	if c.PubEndpoint != "" {
+		return c.PubEndpoint
 	}
+	return formatZMQTCPEndpoint(c.PodIP, c.PubPort)
+}
+
+// replayEndpoint returns the replay URL, or "" if the publisher has none or
+// replay is disabled by topic filters.
+func (c *ZMQClientConfig) replayEndpoint() string {
+	switch {
+	case len(c.Topics) > 0:
+		return ""
+	case c.ReplayEndpoint != "":
+		return c.ReplayEndpoint
+	case c.PubEndpoint != "" || c.RouterPort <= 0:
+		return ""
+	}
+	return formatZMQTCPEndpoint(c.PodIP, c.RouterPort)
+}
+
+// hostnames returns the tcp hostnames the endpoints name, which have to be
+// resolved to reach the publisher.
+func (c *ZMQClientConfig) hostnames() []string {
+	var hosts []string
+	for _, raw := range []string{c.pubEndpoint(), c.replayEndpoint()} {
+		if raw == "" {
+			continue
+		}
+		endpoint, err := ParseEndpoint(raw)
+		if err != nil || !endpoint.IsHostname() || slices.Contains(hosts, endpoint.Host) {
+			continue
+		}
+		hosts = append(hosts, endpoint.Host)
+	}
+	return hosts
 }
 
 // ValidateConfig validates the ZMQ client configuration
 func ValidateConfig(config *ZMQClientConfig) error {
-	if config.PodIP == "" {
-		return fmt.Errorf("pod IP is required")
+	if config.PubEndpoint == "" {
+		if config.PodIP == "" {
+			return fmt.Errorf("pod IP is required")
+		}
+		if err := validateHost(config.PodIP); err != nil {
+			return err
+		}
+
+		// Validate port ranges
+		if config.PubPort <= 0 || config.PubPort > 65535 {
+			return fmt.Errorf("invalid publisher port: %d", config.PubPort)
+		}
+
+		if config.RouterPort < 0 || config.RouterPort > 65535 {
+			return fmt.Errorf("invalid router port: %d", config.RouterPort)
+		}
+	} else if _, err := ParseEndpoint(config.PubEndpoint); err != nil {
+		return fmt.Errorf("invalid publisher endpoint: %w", err)
 	}
 
-	// Validate IP address format
-	if ip := net.ParseIP(config.PodIP); ip == nil {
-		return fmt.Errorf("invalid IP address: %s", config.PodIP)
+	if config.ReplayEndpoint != "" {
+		if _, err := ParseEndpoint(config.ReplayEndpoint); err != nil {
+			return fmt.Errorf("invalid replay endpoint: %w", err)
+		}
 	}
 
-	// Validate port ranges
-	if config.PubPort <= 0 || config.PubPort > 65535 {
-		return fmt.Errorf("invalid publisher port: %d", config.PubPort)
+	if config.ResolveInterval < 0 {
+		return fmt.Errorf("invalid resolve interval: %v", config.ResolveInterval)
 	}
 
-	if config.RouterPort <= 0 || config.RouterPort > 65535 {
-		return fmt.Errorf("invalid router port: %d", config.RouterPort)
+	if config.DPRank < 0 {
+		return fmt.Errorf("invalid data parallel rank: %d", config.DPRank)
 	}
 
-	return nil
-}
+	if config.ReconnectBackoffFactor != 0 && config.ReconnectBackoffFactor < 1 {
+		return fmt.Errorf("invalid reconnect backoff factor: %v", config.ReconnectBackoffFactor)
+	}
+
+	if config.HeartbeatInterval < 0 || config.HeartbeatTimeout < 0 || config.StaleTimeout < 0 {
+		return fmt.Errorf("heartbeat and stale timeouts must not be negative")
+	}
+
+	if config.Curve != nil {
+		if err := config.Curve.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := LookupWireFormat(config.WireFormat); err != nil {
+		return err
+	}
+
+	switch config.GapPolicy {
+	case "", GapPolicyPurge, GapPolicyIgnore:
+	default:
+		return fmt.Errorf("invalid gap policy: %s", config.GapPolicy)
+	}
+
+	if config.QueueSize < 0 {
+		return fmt.Errorf("invalid queue size: %d", config.QueueSize)
+	}
 
+	switch config.OverflowPolicy {
+	case "", OverflowBlock, OverflowDropOldest, OverflowPauseReplay:
+	default:
+		return fmt.Errorf("invalid overflow policy: %s", config.OverflowPolicy)
+	}
 
-```
\ No newline at end of file
+	return nil
+}
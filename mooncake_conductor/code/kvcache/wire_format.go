@@ -0,0 +1,174 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"fmt"
+	"sync"
+)
+
+// EventField identifies a positional field of a vLLM event tuple.
+type EventField int
+
+const (
+	FieldBlockHashes EventField = iota
+	FieldParentBlockHash
+	FieldTokenIDs
+	FieldBlockSize
+	FieldLoraID
+	FieldMedium
+	FieldLoraName
+)
+
+var eventFieldNames = [...]string{
+	FieldBlockHashes:     "block_hashes",
+	FieldParentBlockHash: "parent_block_hash",
+	FieldTokenIDs:        "token_ids",
+	FieldBlockSize:       "block_size",
+	FieldLoraID:          "lora_id",
+	FieldMedium:          "medium",
+	FieldLoraName:        "lora_name",
+}
+
+// String returns the vLLM field name
+func (f EventField) String() string {
+	if f >= 0 && int(f) < len(eventFieldNames) {
+		return eventFieldNames[f]
+	}
+	return fmt.Sprintf("field(%d)", int(f))
+}
+
+// Names of the built-in vLLM wire formats
+const (
+	// WireFormatAuto selects a format per event from the tuple arity
+	WireFormatAuto = "auto"
+
+	// WireFormatVLLMv09 is the original layout (vLLM 0.9):
+	// BlockStored(block_hashes, parent_block_hash, token_ids, block_size, lora_id)
+	WireFormatVLLMv09 = "vllm-0.9"
+
+	// WireFormatVLLMv010 adds the storage medium (vLLM 0.10):
+	// BlockStored(..., medium), BlockRemoved(block_hashes, medium)
+	WireFormatVLLMv010 = "vllm-0.10"
+
+	// WireFormatVLLMv011 adds the LoRA adapter name and allows bytes-valued
+	// block hashes (vLLM 0.11): BlockStored(..., medium, lora_name)
+	WireFormatVLLMv011 = "vllm-0.11"
+)
+
+// WireFormat describes the positional layout of vLLM events after the tag.
+// Fields beyond the layout are skipped; trailing fields omitted by the
+// publisher (msgspec omit_defaults) are left at their zero value.
+type WireFormat struct {
+	Name         string
+	BlockStored  []EventField
+	BlockRemoved []EventField
+}
+
+var (
+	wireFormatsMu sync.RWMutex
+	wireFormats   = map[string]*WireFormat{}
+
+	// wireFormatOrder keeps registration order so auto-detection is deterministic
+	wireFormatOrder []*WireFormat
+)
+
+func init() {
+	RegisterWireFormat(&WireFormat{
+		Name:         WireFormatVLLMv09,
+		BlockStored:  []EventField{FieldBlockHashes, FieldParentBlockHash, FieldTokenIDs, FieldBlockSize, FieldLoraID},
+		BlockRemoved: []EventField{FieldBlockHashes},
+	})
+	RegisterWireFormat(&WireFormat{
+		Name:         WireFormatVLLMv010,
+		BlockStored:  []EventField{FieldBlockHashes, FieldParentBlockHash, FieldTokenIDs, FieldBlockSize, FieldLoraID, FieldMedium},
+		BlockRemoved: []EventField{FieldBlockHashes, FieldMedium},
+	})
+	RegisterWireFormat(&WireFormat{
+		Name:         WireFormatVLLMv011,
+		BlockStored:  []EventField{FieldBlockHashes, FieldParentBlockHash, FieldTokenIDs, FieldBlockSize, FieldLoraID, FieldMedium, FieldLoraName},
+		BlockRemoved: []EventField{FieldBlockHashes, FieldMedium},
+	})
+}
+
+// RegisterWireFormat adds or replaces a wire format in the registry.
+func RegisterWireFormat(format *WireFormat) {
+	wireFormatsMu.Lock()
+	defer wireFormatsMu.Unlock()
+
+	if existing, ok := wireFormats[format.Name]; ok {
+		for i, f := range wireFormatOrder {
+			if f == existing {
+				wireFormatOrder[i] = format
+			}
+		}
+	} else {
+		wireFormatOrder = append(wireFormatOrder, format)
+	}
+	wireFormats[format.Name] = format
+}
+
+// LookupWireFormat returns the registered format with the given name.
+// An empty name or WireFormatAuto returns nil, meaning auto-detection.
+func LookupWireFormat(name string) (*WireFormat, error) {
+	if name == "" || name == WireFormatAuto {
+		return nil, nil
+	}
+
+	wireFormatsMu.RLock()
+	defer wireFormatsMu.RUnlock()
+	format, ok := wireFormats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown wire format: %s", name)
+	}
+	return format, nil
+}
+
+// detectWireFormat picks the format whose layout matches the number of
+// fields (excluding the tag) of an event. If none matches exactly, the
+// smallest layout that covers all fields is used, else the largest one.
+func detectWireFormat(eventType EventType, fields int) *WireFormat {
+	wireFormatsMu.RLock()
+	defer wireFormatsMu.RUnlock()
+
+	var covering, largest *WireFormat
+	for _, format := range wireFormatOrder {
+		n := len(format.layout(eventType))
+		if n == fields {
+			return format
+		}
+		if n > fields && (covering == nil || n < len(covering.layout(eventType))) {
+			covering = format
+		}
+		if largest == nil || n > len(largest.layout(eventType)) {
+			largest = format
+		}
+	}
+	if covering != nil {
+		return covering
+	}
+	return largest
+}
+
+func (f *WireFormat) layout(eventType EventType) []EventField {
+	switch eventType {
+	case EventTypeBlockStored:
+		return f.BlockStored
+	case EventTypeBlockRemoved:
+		return f.BlockRemoved
+	default:
+		return nil
+	}
+}
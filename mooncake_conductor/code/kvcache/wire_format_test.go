@@ -0,0 +1,144 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectWireFormat(t *testing.T) {
+	cases := []struct {
+		name      string
+		eventType EventType
+		fields    int
+		want      string
+	}{
+		// Exact arity
+		{name: "vllm-0.9 BlockStored", eventType: EventTypeBlockStored, fields: 5, want: WireFormatVLLMv09},
+		{name: "vllm-0.10 BlockStored", eventType: EventTypeBlockStored, fields: 6, want: WireFormatVLLMv010},
+		{name: "vllm-0.11 BlockStored", eventType: EventTypeBlockStored, fields: 7, want: WireFormatVLLMv011},
+		{name: "vllm-0.9 BlockRemoved", eventType: EventTypeBlockRemoved, fields: 1, want: WireFormatVLLMv09},
+		{
+			// 0.10 and 0.11 share the layout; the first registered wins
+			name: "vllm-0.10 BlockRemoved", eventType: EventTypeBlockRemoved, fields: 2, want: WireFormatVLLMv010,
+		},
+
+		// Trailing defaults omitted: the smallest layout covering the fields
+		{name: "BlockStored without lora_id", eventType: EventTypeBlockStored, fields: 4, want: WireFormatVLLMv09},
+
+		// Mooncake-shaped tuples, [keys, tier] after the tag
+		{name: "Mooncake-shaped BlockStored", eventType: EventTypeBlockStored, fields: 2, want: WireFormatVLLMv09},
+		{name: "Mooncake-shaped BlockRemoved", eventType: EventTypeBlockRemoved, fields: 2, want: WireFormatVLLMv010},
+
+		// Fields from a newer release: the largest layout, extras skipped
+		{name: "BlockStored from a newer vLLM", eventType: EventTypeBlockStored, fields: 9, want: WireFormatVLLMv011},
+		{name: "BlockRemoved from a newer vLLM", eventType: EventTypeBlockRemoved, fields: 3, want: WireFormatVLLMv010},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			format := detectWireFormat(tc.eventType, tc.fields)
+			if format == nil || format.Name != tc.want {
+				t.Errorf("detectWireFormat(%s, %d) = %v, want %s", tc.eventType, tc.fields, format, tc.want)
+			}
+		})
+	}
+}
+
+// TestPinnedWireFormat checks that a configured wire format overrides the
+// detection, also when it does not match what the publisher sends.
+func TestPinnedWireFormat(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	loraID := int64(3)
+	stored := &BlockStoredEvent{
+		Type:        EventTypeBlockStored,
+		Timestamp:   ts,
+		BlockHashes: []BlockHash{Int64BlockHash(1)},
+		TokenIDs:    [][]int32{{1, 2}},
+		BlockSize:   2,
+		LoraID:      &loraID,
+		Medium:      MediumGPU,
+		LoraName:    "adapter",
+	}
+
+	cases := []struct {
+		name         string
+		sent         string // Format the publisher encodes with
+		pinned       string
+		wantMedium   string
+		wantLoraName string
+	}{
+		{name: "detected vllm-0.11", sent: WireFormatVLLMv011, pinned: WireFormatAuto, wantMedium: MediumGPU, wantLoraName: "adapter"},
+		{name: "detected vllm-0.9", sent: WireFormatVLLMv09, pinned: "", wantMedium: "", wantLoraName: ""},
+		{name: "pinned matches", sent: WireFormatVLLMv010, pinned: WireFormatVLLMv010, wantMedium: MediumGPU},
+		{
+			// The fields 0.10 does not know are skipped
+			name: "pinned older than sent", sent: WireFormatVLLMv011, pinned: WireFormatVLLMv010, wantMedium: MediumGPU,
+		},
+		{name: "pinned much older than sent", sent: WireFormatVLLMv011, pinned: WireFormatVLLMv09},
+		{
+			// The fields the publisher does not send stay unset
+			name: "pinned newer than sent", sent: WireFormatVLLMv09, pinned: WireFormatVLLMv011,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := EncodeEventBatchWithFormat(&EventBatch{Timestamp: ts, Events: []KVEvent{stored}}, tc.sent)
+			if err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			batch, err := DecodeEventBatchWithFormat(payload, tc.pinned)
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+			defer batch.Release()
+
+			got, ok := batch.Events[0].(*BlockStoredEvent)
+			if !ok {
+				t.Fatalf("decoded %T, want *BlockStoredEvent", batch.Events[0])
+			}
+			if len(got.BlockHashes) != 1 || got.BlockHashes[0] != Int64BlockHash(1) || got.BlockSize != 2 ||
+				got.LoraID == nil || *got.LoraID != loraID {
+				t.Errorf("decoded %+v, want the fields all formats share", got)
+			}
+			if got.Medium != tc.wantMedium || got.LoraName != tc.wantLoraName {
+				t.Errorf("medium, lora_name = %q, %q; want %q, %q", got.Medium, got.LoraName, tc.wantMedium, tc.wantLoraName)
+			}
+		})
+	}
+
+	if _, err := DecodeEventBatchWithFormat(goldenVLLMv010, "vllm-9.9"); err == nil {
+		t.Error("decoded with an unknown wire format")
+	}
+}
+
+// TestWireFormatMooncakePayload checks that a Mooncake notification batch
+// read as vLLM events fails cleanly, whether detected or pinned.
+func TestWireFormatMooncakePayload(t *testing.T) {
+	for _, format := range []string{WireFormatAuto, WireFormatVLLMv09, WireFormatVLLMv011} {
+		batch, err := DecodeEventBatchWithFormat(mooncakePayload, format)
+		if err == nil {
+			batch.Release()
+			t.Errorf("%s: decoded a Mooncake payload as vLLM events", format)
+			continue
+		}
+		if !strings.Contains(err.Error(), "unknown event type: Put") {
+			t.Errorf("%s: error = %v, want an unknown event type", format, err)
+		}
+	}
+}
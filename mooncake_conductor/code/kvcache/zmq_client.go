@@ -1,35 +1,123 @@
-//go:build zmq
-// +build zmq
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
 
 package kvcache
 
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"slices"
 	"sync"
 	"time"
-
-	zmq "github.com/pebbe/zmq4"
 )
 
+// replayEndSeq marks the end of a replay stream (vLLM END_SEQ, -1 as 8-byte big-endian)
+const replayEndSeq int64 = -1
+
+// resolveTimeout bounds one re-resolution of the publisher hostnames
+const resolveTimeout = 5 * time.Second
+
+// errReplayNotCovered reports that the publisher's replay buffer no longer
+// holds the requested batches
+var errReplayNotCovered = errors.New("replay buffer does not cover the requested range")
+
+// errRecoveredOutOfOrder quarantines a redecoded batch again because later
+// batches were handled since
+var errRecoveredOutOfOrder = errors.New("later batches were handled since the message was quarantined")
+
 // StaticZMQClient is a simplified ZMQ client optimized for static service deployments.
 type StaticZMQClient struct {
 	config *ZMQClientConfig
 
-	// ZMQ sockets
-	subSocket    *zmq.Socket
-	replaySocket *zmq.Socket
+	// Connection to the publisher; created by NewTransport unless set
+	transport Transport
 
-	// Event handler
+	// Payload decoder and event handler
+	decoder      Decoder
 	eventHandler EventHandler
 
-	// State management
-	mu             sync.RWMutex
-	connected      bool
-	lastSeq        int64
-	reconnectDelay time.Duration
+	// Quarantine for undecodable payloads (optional)
+	deadLetters *DeadLetterStore
+
+	// Batches waiting for the handler worker
+	queue *handlerQueue
+
+	// State management. open means the transport is connected, while peer
+	// tracks whether the publisher is actually reachable through it.
+	mu      sync.RWMutex
+	open    bool
+	peer    PeerStatus
+	lastSeq int64
+
+	// First sequence applied by the latest replay. Live batches from there
+	// up to lastSeq were queued during the replay and are duplicates.
+	replayFrom int64
+	duplicates uint64
+
+	// Checkpointed sequence the stream resumed from, until a batch past it
+	// is applied. A publisher that restarted while the client was down
+	// sends it or an earlier one next.
+	resumeSeq int64
+
+	// Live messages read while a replay ran, oldest first, and the receive
+	// error that ended the reading. Only used by the loop goroutine.
+	pending    [][][]byte
+	pendingErr error
+
+	// Publisher restarts, detected from sequence resets
+	restarts int
+
+	// Reconnect state, reported by Status. The backoff is only reset once a
+	// connection is confirmed by a message or a connected peer, so a
+	// publisher that drops every connection right away keeps backing off.
+	backoff           *reconnectBackoff
+	reconnectAttempts int
+	lastError         string
+	nextRetry         time.Time
+	confirmed         bool
+
+	// Liveness watchdog
+	lastMessageAt time.Time
+	stale         bool
+
+	// Hostname re-resolution: the addresses the publisher hostnames last
+	// resolved to, and when to resolve them again. Lookups run on their own
+	// goroutine; lookup is the one in flight, if any. Only used by the loop
+	// goroutine.
+	hostnames   []string
+	resolved    []string
+	nextResolve time.Time
+	lookup      *hostLookup
+	lookupHost  func(ctx context.Context, host string) ([]string, error)
+
+	// Checkpoints (optional): handledSeq is the last batch handed to the
+	// handler, savedSeq the last one written to the store
+	checkpoints *CheckpointStore
+	handledSeq  int64
+	savedSeq    int64
+
+	// Set by the worker once OverflowDropOldest discarded a batch that no
+	// clear has covered since; handledSeq is held meanwhile
+	evicted bool
+
+	// Sequence of the batch the worker handled last, or -1 after a clear.
+	// Only a recovered dead letter of that batch may still be applied.
+	workerSeq int64
 
 	// Lifecycle
 	ctx    context.Context
@@ -38,49 +126,118 @@ type StaticZMQClient struct {
 }
 
 // NewStaticZMQClient creates a new client instance.
-func NewStaticZMQClient(config *ZMQClientConfig, handler EventHandler) *StaticZMQClient {
+// A nil decoder decodes vLLM events using config.WireFormat.
+func NewStaticZMQClient(config *ZMQClientConfig, handler EventHandler, decoder Decoder) *StaticZMQClient {
+	if decoder == nil {
+		decoder = DecoderFunc(func(payload []byte) (*EventBatch, error) {
+			return DecodeEventBatchWithFormat(payload, config.WireFormat)
+		})
+	}
+
+	maxDelay := config.MaxReconnectDelay
+	if maxDelay <= 0 {
+		maxDelay = MaxReconnectInterval
+	}
+	factor := config.ReconnectBackoffFactor
+	if factor == 0 {
+		factor = ReconnectBackoffFactor
+	}
+
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = EventChannelBufferSize
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	return &StaticZMQClient{
-		config:         config,
-		eventHandler:   handler,
-		lastSeq:        -1,
-		reconnectDelay: config.ReconnectDelay,
-		ctx:            ctx,
-		cancel:         cancel,
+		config:       config,
+		decoder:      decoder,
+		eventHandler: handler,
+		queue:        newHandlerQueue(queueSize),
+		lastSeq:      -1,
+		replayFrom:   -1,
+		resumeSeq:    -1,
+		workerSeq:    -1,
+		handledSeq:   -1,
+		savedSeq:     -1,
+		peer:         PeerStatus{State: ConnectionStateDisconnected},
+		backoff:      newReconnectBackoff(config.ReconnectDelay, maxDelay, factor),
+		lookupHost:   net.DefaultResolver.LookupHost,
+		ctx:          ctx,
+		cancel:       cancel,
 	}
 }
 
+// SetTransport sets the connection to the publisher, e.g. a MemoryTransport.
+// It must be called before Start.
+func (c *StaticZMQClient) SetTransport(transport Transport) {
+	c.transport = transport
+}
+
+// SetDeadLetterStore sets where undecodable payloads are quarantined.
+// It must be called before Start.
+func (c *StaticZMQClient) SetDeadLetterStore(store *DeadLetterStore) {
+	c.deadLetters = store
+}
+
+// SetCheckpointStore sets where the stream position is saved, so a
+// restarted client resumes from it. It must be called before Start.
+func (c *StaticZMQClient) SetCheckpointStore(store *CheckpointStore) {
+	c.checkpoints = store
+}
+
 // Start initiates the connection and background event consumption loop.
 func (c *StaticZMQClient) Start() error {
+	resume := c.loadCheckpoint()
+
 	// Attempt initial connection
 	if err := c.Connect(); err != nil {
 		return fmt.Errorf("initial connection failed: %w", err)
 	}
 
-	c.wg.Add(1)
-	go c.loop()
+	// The watchdog counts from start until the first message
+	c.mu.Lock()
+	c.lastMessageAt = time.Now()
+	c.mu.Unlock()
+	c.updatePeer()
+
+	if c.config.ResolveInterval > 0 {
+		c.hostnames = c.config.hostnames()
+	}
+
+	c.wg.Add(2)
+	go c.loop(resume)
+	go c.work()
 
 	slog.Info("Static ZMQ client started", "service", c.config.PodKey)
 	return nil
 }
 
-// Stop gracefully shuts down the client.
+// Stop gracefully shuts down the client. Batches still queued for the
+// handler are discarded.
 func (c *StaticZMQClient) Stop() {
 	c.cancel()
 	c.wg.Wait()
 
 	c.mu.Lock()
-	c.cleanupSockets()
+	c.closeTransport()
 	c.mu.Unlock()
 
+	c.saveCheckpoint()
+
 	slog.Info("Static ZMQ client stopped", "service", c.config.PodKey)
 }
 
 // loop is the main background loop handling events and reconnections.
-// Simplified: Fixed reconnect interval, single loop structure.
-func (c *StaticZMQClient) loop() {
+// It only reads and sequences batches; the handler runs on work. With
+// resume, it first replays what was published since the checkpoint.
+func (c *StaticZMQClient) loop(resume bool) {
 	defer c.wg.Done()
 
+	if resume {
+		c.catchUp("Resuming from checkpoint")
+	}
+
 	for {
 		// Check if we should stop
 		select {
@@ -89,256 +246,1032 @@ func (c *StaticZMQClient) loop() {
 		default:
 		}
 
-		// 1. If disconnected, wait for ticker then try to reconnect
-		if !c.isConnected() {
+		c.checkStale()
+		c.checkResolve()
+		c.updatePeer()
+
+		// 1. If disconnected, back off then try to reconnect
+		if !c.isOpen() {
 			c.handleReconnect()
 			continue
 		}
 
 		// 2. If connected, consume events
 		if err := c.consume(); err != nil {
-			slog.Error("Consumption error", "service", c.config.PodKey, "error", err)
-			c.markDisconnected()
+			if errors.Is(err, ErrHandshakeRejected) {
+				slog.Error("Publisher rejected the handshake, check the CURVE keys",
+					"service", c.config.PodKey,
+					"error", err,
+				)
+			} else {
+				slog.Error("Consumption error", "service", c.config.PodKey, "error", err)
+			}
+			c.markDisconnected(err)
 		}
 	}
 }
 
-func (c *StaticZMQClient) handleReconnect() {
-	slog.Info("Attempting to reconnect to %s after %v", c.config.PodKey, c.reconnectDelay)
+// updatePeer refreshes the connection state from the transport and logs
+// when it changes.
+func (c *StaticZMQClient) updatePeer() {
+	c.mu.Lock()
+	before := c.state()
+	if c.open {
+		c.peer = c.transport.PeerStatus()
+		if c.peer.State == ConnectionStateConnected {
+			c.confirmLocked()
+		}
+	} else {
+		c.peer.State = ConnectionStateDisconnected
+	}
+	after := c.state()
+	retries := c.peer.Retries
+	c.mu.Unlock()
 
-	ticker := time.NewTicker(c.config.ReconnectDelay)
-	defer ticker.Stop()
+	if before != after {
+		slog.Info("Connection state changed",
+			"service", c.config.PodKey,
+			"from", before,
+			"to", after,
+			"retries", retries,
+		)
+	}
+}
 
-	select {
-	case <-c.ctx.Done():
+// state derives the connection state; the caller holds c.mu. A stream is
+// only reported stale while the publisher appears connected, since
+// otherwise the connection state already explains the silence.
+func (c *StaticZMQClient) state() ConnectionState {
+	if !c.open {
+		return ConnectionStateDisconnected
+	}
+	if c.stale && c.peer.State == ConnectionStateConnected {
+		return ConnectionStateStale
+	}
+	return c.peer.State
+}
+
+// work passes queued batches to the event handler until the client stops.
+// The checkpoint is saved at most every DefaultCheckpointInterval.
+func (c *StaticZMQClient) work() {
+	defer c.wg.Done()
+
+	var save <-chan time.Time
+	for {
+		item, ok := c.queue.pop()
+		if !ok {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-c.queue.ready:
+			case <-save:
+				c.saveCheckpoint()
+				save = nil
+			}
+			continue
+		}
+
+		if item.evicted {
+			c.handleEviction(item.seq)
+		}
+		c.handleQueued(item)
+		if item.clear {
+			c.evicted = false
+			c.workerSeq = -1
+		}
+		if item.sequenced {
+			c.workerSeq = item.seq
+		}
+		if item.sequenced && !c.evicted {
+			c.mu.Lock()
+			c.handledSeq = item.seq
+			c.mu.Unlock()
+			if save == nil && c.checkpoints != nil {
+				save = time.After(DefaultCheckpointInterval)
+			}
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-save:
+			c.saveCheckpoint()
+			save = nil
+		default:
+		}
+	}
+}
+
+// handleEviction treats batches discarded by OverflowDropOldest like a gap
+// that cannot be replayed. Under GapPolicyPurge the service starts over
+// before the next batch; otherwise handledSeq is held until a clear, so a
+// client restarted from its checkpoint replays the lost range.
+func (c *StaticZMQClient) handleEviction(seq int64) {
+	policy := c.config.GapPolicy
+	if policy == "" {
+		policy = DefaultGapPolicy
+	}
+	slog.Warn("Queued batches dropped",
+		"service", c.config.PodKey,
+		"before", seq,
+		"policy", policy,
+	)
+
+	if policy == GapPolicyPurge {
+		c.handleBatch("", clearedBatch())
+		c.evicted = false
+		c.workerSeq = -1
 		return
-	case <-ticker.C:
 	}
+	c.evicted = true
+}
 
-	if err := c.Connect(); err != nil {
-		slog.Error("Reconnect failed", "service", c.config.PodKey, "error", err)
+// publisherIdentity names the stream a sequence belongs to.
+func (c *StaticZMQClient) publisherIdentity() string {
+	return c.config.pubEndpoint()
+}
+
+// loadCheckpoint restores the stream position from the checkpoint store.
+// It reports whether there is a position to resume from.
+func (c *StaticZMQClient) loadCheckpoint() bool {
+	if c.checkpoints == nil {
+		return false
 	}
 
-	// Reconnected! Request replay from last known sequence
-	lastSeq := c.getLastSequence()
-	if lastSeq >= 0 {
-		slog.Info("Reconnected", "service", c.config.PodKey, "resuming_from", lastSeq+1)
-		if err := c.requestReplay(lastSeq + 1); err != nil {
-			slog.Warn("Failed to request replay after reconnect for %s: %v", c.config.PodKey, err)
+	checkpoint, err := c.checkpoints.Load(c.config.PodKey)
+	if err != nil {
+		slog.Warn("Ignoring unreadable checkpoint", "service", c.config.PodKey, "error", err)
+		return false
+	}
+	if checkpoint == nil || checkpoint.Seq < 0 {
+		return false
+	}
+	if checkpoint.Publisher != c.publisherIdentity() {
+		slog.Warn("Ignoring checkpoint of another publisher",
+			"service", c.config.PodKey,
+			"checkpoint", checkpoint.Publisher,
+			"publisher", c.publisherIdentity(),
+		)
+		return false
+	}
+
+	c.mu.Lock()
+	c.lastSeq = checkpoint.Seq
+	c.resumeSeq = checkpoint.Seq
+	c.handledSeq = checkpoint.Seq
+	c.savedSeq = checkpoint.Seq
+	c.mu.Unlock()
+
+	slog.Info("Loaded checkpoint",
+		"service", c.config.PodKey,
+		"seq", checkpoint.Seq,
+		"saved_at", checkpoint.UpdatedAt,
+	)
+	return true
+}
+
+// saveCheckpoint writes the last handled sequence if it changed.
+func (c *StaticZMQClient) saveCheckpoint() {
+	if c.checkpoints == nil {
+		return
+	}
+
+	c.mu.RLock()
+	seq, saved := c.handledSeq, c.savedSeq
+	c.mu.RUnlock()
+	if seq < 0 || seq == saved {
+		return
+	}
+
+	err := c.checkpoints.Save(Checkpoint{
+		Service:   c.config.PodKey,
+		Publisher: c.publisherIdentity(),
+		Seq:       seq,
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		slog.Error("Failed to save checkpoint", "service", c.config.PodKey, "seq", seq, "error", err)
+		return
+	}
+
+	c.mu.Lock()
+	c.savedSeq = seq
+	c.mu.Unlock()
+}
+
+// handleQueued decodes and handles one queued batch. A bad payload is
+// quarantined rather than treated as a connection failure, so the
+// subscription keeps running.
+func (c *StaticZMQClient) handleQueued(item queuedBatch) {
+	if item.recovered && (item.seq < 0 || item.seq != c.workerSeq) {
+		// Later batches or a clear were handled since; applying it now
+		// could bring back blocks they removed
+		item.batch.Release()
+		c.quarantine(item.topic, item.seq, item.payload, errRecoveredOutOfOrder)
+		return
+	}
+
+	batch := item.batch
+	if batch == nil {
+		var err error
+		if batch, err = c.decoder.Decode(item.payload); err != nil {
+			c.quarantine(item.topic, item.seq, item.payload, err)
+			return
 		}
 	}
 
+	c.handleBatch(string(item.topic), batch)
+
+	slog.Debug("Processed batch", "service", c.config.PodKey, "seq", item.seq, "topic", string(item.topic))
 }
 
-// Connect establishes the ZMQ SUB and DEALER sockets.
-func (c *StaticZMQClient) Connect() error {
+// checkStale marks the stream stale once no message arrived within
+// StaleTimeout, whether or not the client is connected.
+func (c *StaticZMQClient) checkStale() {
+	timeout := c.config.StaleTimeout
+	if timeout <= 0 {
+		return
+	}
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	idle := time.Since(c.lastMessageAt)
+	if c.stale || idle < timeout {
+		c.mu.Unlock()
+		return
+	}
+	c.stale = true
+	peer := c.peer.State
+	c.mu.Unlock()
+
+	slog.Warn("Publisher stream is stale",
+		"service", c.config.PodKey,
+		"idle", idle.Round(time.Second),
+		"peer", peer,
+	)
+	c.notifyStale(true)
+}
+
+// hostLookup is a background resolution of the publisher hostnames.
+type hostLookup struct {
+	done  chan struct{} // Closed once addrs is set
+	addrs []string      // Sorted addresses, nil if a lookup failed
+}
+
+// checkResolve resolves the publisher hostnames every ResolveInterval and
+// reconnects when their addresses changed. Sockets only resolve when they
+// dial, so an established connection would otherwise stay with a publisher
+// that moved until it fails. The lookup runs in the background, so a slow
+// DNS server does not hold up the stream.
+func (c *StaticZMQClient) checkResolve() {
+	if c.lookup != nil {
+		select {
+		case <-c.lookup.done:
+			addrs := c.lookup.addrs
+			c.lookup = nil
+			c.applyResolved(addrs)
+		default:
+			return
+		}
+	}
+	if len(c.hostnames) == 0 || time.Now().Before(c.nextResolve) {
+		return
+	}
+	c.nextResolve = time.Now().Add(c.config.ResolveInterval)
+
+	c.lookup = &hostLookup{done: make(chan struct{})}
+	c.wg.Add(1)
+	go c.resolve(c.lookup)
+}
+
+// resolve looks up all publisher hostnames.
+func (c *StaticZMQClient) resolve(lookup *hostLookup) {
+	defer c.wg.Done()
+	defer close(lookup.done)
 
-	if c.connected {
+	ctx, cancel := context.WithTimeout(c.ctx, resolveTimeout)
+	defer cancel()
+
+	var addrs []string
+	for _, host := range c.hostnames {
+		resolved, err := c.lookupHost(ctx, host)
+		if err != nil {
+			slog.Warn("Failed to resolve publisher host", "service", c.config.PodKey, "host", host, "error", err)
+			return
+		}
+		addrs = append(addrs, resolved...)
+	}
+	slices.Sort(addrs)
+	lookup.addrs = addrs
+}
+
+// applyResolved reconnects if a lookup found other addresses than the
+// previous one.
+func (c *StaticZMQClient) applyResolved(addrs []string) {
+	if addrs == nil {
+		return
+	}
+
+	previous := c.resolved
+	c.resolved = addrs
+	if previous == nil || slices.Equal(previous, addrs) {
+		return
+	}
+
+	slog.Info("Publisher addresses changed, reconnecting",
+		"service", c.config.PodKey,
+		"hosts", c.hostnames,
+		"addresses", addrs,
+	)
+	if c.isOpen() {
+		c.markDisconnected(fmt.Errorf("publisher addresses changed to %v", addrs))
+	}
+}
+
+// lookupDone returns a channel closed once the lookup in flight finished,
+// or nil if none is.
+func (c *StaticZMQClient) lookupDone() <-chan struct{} {
+	if c.lookup == nil {
 		return nil
 	}
+	return c.lookup.done
+}
 
-	// Ensure clean state
-	c.cleanupSockets()
+// notifyStale tells the event handler about a liveness change and queues
+// the clear it asks for.
+func (c *StaticZMQClient) notifyStale(stale bool) {
+	if handler, ok := c.eventHandler.(LivenessHandler); ok && handler.HandleStale(stale) {
+		c.queueClear()
+	}
+}
+
+// handleReconnect waits out the backoff delay and makes one reconnect
+// attempt. Missed batches are only replayed once the attempt succeeded.
+func (c *StaticZMQClient) handleReconnect() {
+	c.mu.Lock()
+	delay := c.backoff.next()
+	c.nextRetry = time.Now().Add(delay)
+	attempt := c.reconnectAttempts + 1
+	c.mu.Unlock()
+
+	slog.Info("Scheduling reconnect",
+		"service", c.config.PodKey,
+		"attempt", attempt,
+		"delay", delay,
+	)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-c.ctx.Done():
+		return
+	case <-timer.C:
+	}
 
-	// Create Sockets
-	sock, err := zmq.NewSocket(zmq.SUB)
+	err := c.Connect()
+	c.mu.Lock()
+	c.reconnectAttempts = attempt
 	if err != nil {
-		return fmt.Errorf("create socket failed: %w", err)
+		c.lastError = err.Error()
+	}
+	c.mu.Unlock()
+	if err != nil {
+		slog.Error("Reconnect failed", "service", c.config.PodKey, "attempt", attempt, "error", err)
+		return
 	}
 
-	if err := sock.SetIpv6(true); err != nil {
-		_ = sock.Close()
-		return fmt.Errorf("failed to enable IPv6 on socket: %w", err)
+	// Reconnected! Request replay from last known sequence
+	c.catchUp("Reconnected")
+}
+
+// catchUp replays every batch published after the last applied one.
+func (c *StaticZMQClient) catchUp(reason string) {
+	lastSeq := c.getLastSequence()
+	if lastSeq < 0 || c.config.replayEndpoint() == "" {
+		return
 	}
 
-	endpoint := formatZMQTCPEndpoint(c.config.PodIP, c.config.PubPort)
-	if err := sock.Connect(endpoint); err != nil {
-		_ = sock.Close()
-		return fmt.Errorf("failed to connect to %s: %w", endpoint, err)
+	slog.Info(reason, "service", c.config.PodKey, "resuming_from", lastSeq+1)
+	recovered, err := c.requestReplay(lastSeq+1, -1)
+	if errors.Is(err, errReplayNotCovered) {
+		c.handleUnrecoverableGap(lastSeq, c.getLastSequence()+1, err)
+	} else if err != nil {
+		slog.Warn("Catch-up replay failed",
+			"service", c.config.PodKey,
+			"recovered", recovered,
+			"error", err,
+		)
 	}
+}
+
+// Connect opens the transport to the publisher. The publisher is reached
+// asynchronously; Status reports when it is.
+func (c *StaticZMQClient) Connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	// Important: Subscribe to all topics
-	if err := sock.SetSubscribe(""); err != nil {
-		_ = sock.Close()
-		return fmt.Errorf("failed to subscribe: %w", err)
+	if c.open {
+		return nil
 	}
 
-	replaySocket, err := zmq.NewSocket(zmq.DEALER)
-	if err != nil {
-		sock.Close()
-		return fmt.Errorf("failed to create DEALER socket: %w", err)
+	if c.transport == nil {
+		transport, err := NewTransport(c.config)
+		if err != nil {
+			return fmt.Errorf("failed to create transport: %w", err)
+		}
+		c.transport = transport
 	}
 
-	c.subSocket = sock
-	c.replaySocket = replaySocket
-	c.connected = true
+	if err := c.transport.Connect(); err != nil {
+		return err
+	}
+	c.open = true
+	c.confirmed = false
+	c.nextRetry = time.Time{}
 
-	slog.Info("Successfully connected to vLLM pod %s at %s", c.config.PodKey, c.config.PodIP)
+	slog.Info("Connecting to publisher",
+		"service", c.config.PodKey,
+		"endpoint", c.config.pubEndpoint(),
+	)
 
 	return nil
 }
 
-// consume reads and processes messages from the SUB socket.
+// consume reads and processes one message from the publisher.
 func (c *StaticZMQClient) consume() error {
 	c.mu.RLock()
-	socket := c.subSocket
+	transport := c.transport
 	c.mu.RUnlock()
 
-	if socket == nil {
-		return fmt.Errorf("socket is nil")
+	if transport == nil {
+		return fmt.Errorf("transport is nil")
 	}
 
-	poller := zmq.NewPoller()
-	poller.Add(socket, zmq.POLLIN)
-
-	// Poll for data
-	polled, err := poller.Poll(c.config.PollTimeout)
+	frames, err := c.next(transport)
 	if err != nil {
-		return fmt.Errorf("poll error: %w", err)
+		return fmt.Errorf("receive error: %w", err)
 	}
-	if len(polled) == 0 {
+	if frames == nil {
+		// A quiet publisher would otherwise leave paused batches unreplayed
+		if c.config.OverflowPolicy == OverflowPauseReplay && c.queue.resume() {
+			c.catchUp("Handler queue drained, resuming")
+		}
 		return nil // No data, continue loop
 	}
 
-	// Process message
-	if err := c.processMessage(socket); err != nil {
-		return fmt.Errorf("failed to process message: %w", err)
+	c.confirm()
+	c.processMessage(frames)
+	return nil
+}
+
+// confirm resets the reconnect backoff once the connection has delivered
+// a message.
+func (c *StaticZMQClient) confirm() {
+	c.mu.Lock()
+	c.confirmLocked()
+	c.mu.Unlock()
+}
+
+func (c *StaticZMQClient) confirmLocked() {
+	if c.confirmed {
+		return
 	}
+	c.confirmed = true
+	c.backoff.reset()
+	c.reconnectAttempts = 0
+}
 
-	return nil
+// next returns the oldest message buffered during a replay, or else
+// receives one.
+func (c *StaticZMQClient) next(transport Transport) ([][]byte, error) {
+	if len(c.pending) > 0 {
+		frames := c.pending[0]
+		c.pending[0] = nil
+		c.pending = c.pending[1:]
+		return frames, nil
+	}
+	if err := c.pendingErr; err != nil {
+		c.pendingErr = nil
+		return nil, err
+	}
+	return c.receive(transport)
+}
 
+// bufferLive reads the live messages that are already waiting, so the
+// publisher does not drop messages while a replay holds up the stream. At
+// most QueueSize messages are buffered.
+func (c *StaticZMQClient) bufferLive(transport Transport) {
+	for c.pendingErr == nil && len(c.pending) < c.queue.capacity {
+		frames, err := transport.Recv(0)
+		if err != nil {
+			c.pendingErr = err
+			return
+		}
+		if frames == nil {
+			return
+		}
+		c.pending = append(c.pending, frames)
+	}
 }
 
-func (c *StaticZMQClient) processMessage(socket *zmq.Socket) error {
+// receive returns the next message, or nil if there is none yet. With a
+// Notifier it takes a waiting message right away and otherwise sleeps
+// until the transport is ready, the stream is due to go stale, a hostname
+// lookup finished or the client stops; without one it polls for
+// PollTimeout.
+func (c *StaticZMQClient) receive(transport Transport) ([][]byte, error) {
+	// A paused queue is rechecked every PollTimeout, see consume
+	notifier, ok := transport.(Notifier)
+	if !ok || c.queue.isPaused() {
+		return transport.Recv(c.config.PollTimeout)
+	}
 
-	if socket == nil {
-		return fmt.Errorf("socket is nil")
+	// A busy stream never parks on the reactor
+	if frames, err := transport.Recv(0); frames != nil || err != nil {
+		return frames, err
+	}
+	ready, cancel := notifier.Notify()
+	if ready == nil {
+		return transport.Recv(c.config.PollTimeout)
 	}
 
-	// Read Frames: [Topic, Seq, Payload]
-	topic, err := socket.RecvBytes(0)
-	if err != nil {
-		return err
+	var wakeTimer <-chan time.Time
+	if wait, ok := c.untilWake(); ok {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		wakeTimer = timer.C
 	}
-	seqBytes, err := socket.RecvBytes(0)
-	if err != nil {
-		return err
+
+	select {
+	case <-ready:
+		return transport.Recv(0)
+	case <-wakeTimer:
+	case <-c.lookupDone():
+	case <-c.ctx.Done():
 	}
-	payload, err := socket.RecvBytes(0)
-	if err != nil {
-		return err
+	cancel()
+	return nil, nil
+}
+
+// untilWake returns how long until the loop has to run its checks again:
+// until the stream is due to go stale or the hostnames to be resolved.
+func (c *StaticZMQClient) untilWake() (time.Duration, bool) {
+	wait, ok := c.untilStale()
+	if len(c.hostnames) > 0 {
+		if until := time.Until(c.nextResolve); !ok || until < wait {
+			wait, ok = until, true
+		}
+	}
+	return wait, ok
+}
+
+// untilStale returns how long until the watchdog marks the stream stale.
+// It returns false if the watchdog is disabled or the stream already stale.
+func (c *StaticZMQClient) untilStale() (time.Duration, bool) {
+	if c.config.StaleTimeout <= 0 {
+		return 0, false
 	}
 
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.stale {
+		return 0, false
+	}
+	return time.Until(c.lastMessageAt.Add(c.config.StaleTimeout)), true
+}
+
+// processMessage applies one live message. Batches are applied strictly in
+// sequence order: gaps are replayed first, batches a replay already
+// applied are skipped and any other regression is a publisher restart.
+func (c *StaticZMQClient) processMessage(frames [][]byte) {
+	// Frames: [Topic, Seq, Payload]. A malformed message is quarantined
+	// with an unknown sequence, the stream itself is still usable.
+	if len(frames) != 3 {
+		var topic, payload []byte
+		if len(frames) > 1 {
+			topic, payload = frames[0], frames[len(frames)-1]
+		}
+		c.quarantine(topic, -1, payload, fmt.Errorf("expected 3 frames, got %d", len(frames)))
+		return
+	}
+	topic, seqBytes, payload := frames[0], frames[1], frames[2]
+
 	// Validate Sequence
 	if len(seqBytes) != 8 {
-		return fmt.Errorf("invalid sequence length")
+		c.quarantine(topic, -1, payload, fmt.Errorf("invalid sequence length %d", len(seqBytes)))
+		return
 	}
 	seq := int64(binary.BigEndian.Uint64(seqBytes))
 
-	// Check Gap
+	// While paused, live batches are left to the replay that follows
+	if c.config.OverflowPolicy == OverflowPauseReplay && !c.admitLive(seq) {
+		return
+	}
+
 	c.mu.RLock()
-	lastSeq := c.lastSeq
+	lastSeq, replayFrom, resumeSeq := c.lastSeq, c.replayFrom, c.resumeSeq
 	c.mu.RUnlock()
 
-	if lastSeq != -1 && seq > lastSeq+1 {
-		slog.Warn("Event gap detected",
+	switch {
+	case lastSeq == -1 || seq == lastSeq+1:
+		// The live stream has moved past the latest replay
+		if replayFrom != -1 {
+			c.mu.Lock()
+			c.replayFrom = -1
+			c.mu.Unlock()
+		}
+	case seq <= lastSeq && replayFrom != -1 && seq >= replayFrom:
+		c.mu.Lock()
+		c.duplicates++
+		c.mu.Unlock()
+		slog.Debug("Skipping replayed batch", "service", c.config.PodKey, "seq", seq)
+		return
+	case seq == lastSeq && resumeSeq == -1:
+		c.mu.Lock()
+		c.duplicates++
+		c.mu.Unlock()
+		slog.Debug("Skipping repeated batch", "service", c.config.PodKey, "seq", seq)
+		return
+	case seq <= lastSeq:
+		// One connection delivers batches in order, so a batch behind the
+		// applied sequence that no replay covered comes from a restarted
+		// publisher counting from 0 again. So does the checkpointed batch
+		// itself when nothing past it was replayed. Drop the old engine's
+		// blocks and recover the start of the new stream like a gap.
+		c.handleRestart(lastSeq, seq)
+		if seq > 0 && c.config.replayEndpoint() != "" {
+			c.recoverGap(-1, seq)
+		}
+	default:
+		// Check Gap. The triggering message is held back while the missing
+		// range is replayed; later live messages are buffered meanwhile.
+		c.recoverGap(lastSeq, seq)
+	}
+
+	c.applyMessage(topic, seq, payload, true)
+}
+
+// handleRestart starts the service over after its publisher restarted.
+func (c *StaticZMQClient) handleRestart(lastSeq, seq int64) {
+	c.mu.Lock()
+	c.restarts++
+	restarts := c.restarts
+	c.lastSeq = -1
+	c.replayFrom = -1
+	c.resumeSeq = -1
+	c.mu.Unlock()
+
+	slog.Warn("Publisher restart detected",
+		"service", c.config.PodKey,
+		"last", lastSeq,
+		"current", seq,
+		"restarts", restarts,
+	)
+	c.queue.push(c.ctx, queuedBatch{batch: clearedBatch(), clear: true})
+}
+
+// queueClear queues a synthesized AllBlocksClearedEvent, which drops every
+// index entry of the service.
+func (c *StaticZMQClient) queueClear() {
+	c.queue.push(c.ctx, queuedBatch{batch: clearedBatch(), clear: true})
+}
+
+func clearedBatch() *EventBatch {
+	return &EventBatch{
+		Timestamp: time.Now(),
+		Events: []KVEvent{&AllBlocksClearedEvent{
+			Type:      EventTypeAllCleared,
+			Timestamp: time.Now(),
+		}},
+	}
+}
+
+// admitLive applies OverflowPauseReplay to a live batch. A batch that is
+// not admitted is dropped without advancing the sequence, so the first
+// batch admitted after the pause finds a gap and replays what was dropped.
+func (c *StaticZMQClient) admitLive(seq int64) bool {
+	ok, change := c.queue.admit()
+	switch change {
+	case 1:
+		slog.Warn("Handler queue full, pausing until it drains",
 			"service", c.config.PodKey,
-			"missed", seq-lastSeq-1,
-			"last", lastSeq,
-			"current", seq,
+			"seq", seq,
 		)
-		// Trigger replay for missed events?
-		// Usually we just log warning here, or could auto-trigger requestReplay
+	case -1:
+		slog.Info("Handler queue drained, resuming", "service", c.config.PodKey, "seq", seq)
+	}
+
+	if !ok {
+		// The publisher is alive even though the batch is dropped
+		c.mu.Lock()
+		c.lastMessageAt = time.Now()
+		c.mu.Unlock()
+	}
+	return ok
+}
+
+// recoverGap replays the batches between lastSeq and seq (both exclusive).
+// If the publisher cannot replay all of them, the gap policy applies.
+func (c *StaticZMQClient) recoverGap(lastSeq, seq int64) {
+	missed := seq - lastSeq - 1
+	slog.Warn("Event gap detected",
+		"service", c.config.PodKey,
+		"missed", missed,
+		"last", lastSeq,
+		"current", seq,
+	)
+
+	maxReplay := int64(c.config.MaxGapReplay)
+	if maxReplay <= 0 {
+		maxReplay = DefaultMaxGapReplay
 	}
 
-	// Update Sequence immediately to keep state fresh
+	switch {
+	case len(c.config.Topics) > 0:
+		c.handleUnrecoverableGap(lastSeq, seq, fmt.Errorf("replay is disabled with topic filters"))
+	case c.config.replayEndpoint() == "":
+		c.handleUnrecoverableGap(lastSeq, seq, fmt.Errorf("publisher has no replay endpoint"))
+	case missed > maxReplay:
+		c.handleUnrecoverableGap(lastSeq, seq, fmt.Errorf("gap of %d exceeds replay limit %d", missed, maxReplay))
+	default:
+		recovered, err := c.requestReplay(lastSeq+1, seq-1)
+		if err == nil && c.getLastSequence() < seq-1 {
+			err = fmt.Errorf("replay ended at %d", c.getLastSequence())
+		}
+		if err != nil {
+			c.handleUnrecoverableGap(lastSeq, seq, err)
+			return
+		}
+		slog.Info("Event gap recovered", "service", c.config.PodKey, "recovered", recovered)
+	}
+}
+
+// handleUnrecoverableGap applies the gap policy to missed batches.
+func (c *StaticZMQClient) handleUnrecoverableGap(lastSeq, seq int64, cause error) {
+	policy := c.config.GapPolicy
+	if policy == "" {
+		policy = DefaultGapPolicy
+	}
+
+	slog.Error("Event gap not recoverable",
+		"service", c.config.PodKey,
+		"last", lastSeq,
+		"current", seq,
+		"policy", policy,
+		"error", cause,
+	)
+
+	// Whatever arrives next starts a fresh sequence
 	c.mu.Lock()
+	c.lastSeq = -1
+	c.replayFrom = -1
+	c.resumeSeq = -1
+	c.mu.Unlock()
+
+	if policy == GapPolicyPurge {
+		// Missed removals may have left stale blocks; start this service over
+		c.queueClear()
+	}
+}
+
+// applyMessage records one published batch as applied and queues it for
+// the handler. Live and replayed messages both go through here; only live
+// ones are subject to OverflowDropOldest, since replays fill known gaps.
+func (c *StaticZMQClient) applyMessage(topic []byte, seq int64, payload []byte, live bool) {
+	// Update Sequence immediately to keep state fresh. The sequence never
+	// moves backwards; only a gap or restart starts it over from -1.
+	c.mu.Lock()
+	if c.lastSeq != -1 && seq <= c.lastSeq {
+		c.duplicates++
+		c.mu.Unlock()
+		slog.Debug("Skipping already applied batch", "service", c.config.PodKey, "seq", seq)
+		return
+	}
 	c.lastSeq = seq
+	c.resumeSeq = -1
+	c.lastMessageAt = time.Now()
+	wasStale := c.stale
+	c.stale = false
 	c.mu.Unlock()
 
-	// Decode & Handle
-	batch, err := DecodeEventBatch(payload)
-	if err != nil {
-		return fmt.Errorf("decode failed: %w", err)
+	if wasStale {
+		slog.Info("Publisher stream recovered", "service", c.config.PodKey, "seq", seq)
+		c.notifyStale(false)
+	}
+
+	item := queuedBatch{topic: topic, seq: seq, payload: payload, sequenced: true}
+	if !live || c.config.OverflowPolicy != OverflowDropOldest {
+		c.queue.push(c.ctx, item)
+		return
+	}
+	if dropped, first := c.queue.pushDropOldest(c.ctx, item); first {
+		slog.Warn("Handler queue full, dropping oldest batches",
+			"service", c.config.PodKey,
+			"seq", seq,
+		)
+	} else if dropped {
+		slog.Debug("Dropped oldest queued batch", "service", c.config.PodKey, "seq", seq)
 	}
+}
 
-	slog.Info("Get batch!!!!!!!!")
+// handleBatch tags the events of a decoded batch with their source and
+// passes them to the event handler. Replayed batches have no topic.
+func (c *StaticZMQClient) handleBatch(topic string, batch *EventBatch) {
+	// Prefer the rank stamped by the publisher over the configured one
+	dpRank := c.config.DPRank
+	if batch.DataParallelRank != nil {
+		if *batch.DataParallelRank != dpRank {
+			slog.Warn("Data parallel rank mismatch",
+				"service", c.config.PodKey,
+				"configured", dpRank,
+				"reported", *batch.DataParallelRank,
+			)
+		}
+		dpRank = *batch.DataParallelRank
+	}
 
 	for _, event := range batch.Events {
-		// Inject Source Name
+		// Inject Source Name and rank
 		switch e := event.(type) {
 		case *BlockStoredEvent:
 			e.PodName = c.config.PodKey
+			e.DPRank = dpRank
+			e.Topic = topic
 		case *BlockRemovedEvent:
 			e.PodName = c.config.PodKey
+			e.DPRank = dpRank
+			e.Topic = topic
+		case *AllBlocksClearedEvent:
+			e.PodName = c.config.PodKey
+			e.DPRank = dpRank
+			e.Topic = topic
 		}
 
 		if err := c.eventHandler.HandleEvent(event); err != nil {
 			slog.Error("Handler error", "service", c.config.PodKey, "error", err)
 		}
 	}
+	batch.Release()
+}
 
-	slog.Debug("Processed batch", "service", c.config.PodKey, "seq", seq, "topic", string(topic))
-	return nil
+// quarantine records a malformed or undecodable message in the dead letter
+// store. seq is -1 when the message carried no valid sequence.
+func (c *StaticZMQClient) quarantine(topic []byte, seq int64, payload []byte, err error) {
+	slog.Error("Bad message quarantined",
+		"service", c.config.PodKey,
+		"seq", seq,
+		"payload_len", len(payload),
+		"error", err,
+	)
+	if c.deadLetters == nil {
+		return
+	}
+	c.deadLetters.Add(DeadLetter{
+		Service:    c.config.PodKey,
+		Topic:      topic,
+		Seq:        seq,
+		Payload:    payload,
+		Error:      err.Error(),
+		ReceivedAt: time.Now(),
+	})
+}
 
+// RedecodeDeadLetters retries this client's quarantined messages with its
+// current decoder. A recovered batch is only handled if no later batch or
+// clear was handled since it was quarantined, which leaves the latest one
+// at most; the others are quarantined again with errRecoveredOutOfOrder.
+func (c *StaticZMQClient) RedecodeDeadLetters() (int, error) {
+	if c.deadLetters == nil {
+		return 0, nil
+	}
+	return c.deadLetters.Redecode(c.config.PodKey, c.decoder, func(letter DeadLetter, batch *EventBatch) {
+		slog.Info("Recovered quarantined message", "service", c.config.PodKey, "seq", letter.Seq)
+		c.queue.push(c.ctx, queuedBatch{
+			topic:     letter.Topic,
+			seq:       letter.Seq,
+			payload:   letter.Payload,
+			batch:     batch,
+			recovered: true,
+		})
+	})
 }
 
-func (c *StaticZMQClient) requestReplay(fromSeq int64) error {
+// requestReplay asks the publisher for every buffered batch from fromSeq on.
+// vLLM answers with one [seq, payload] message per batch and terminates the
+// stream with replayEndSeq. Replayed batches up to toSeq (-1 for no bound) are applied
+// like live ones, as long as they continue the applied sequence. It returns
+// the number of batches recovered, which is valid even when an error is
+// returned; errReplayNotCovered means the publisher no longer buffers fromSeq.
+func (c *StaticZMQClient) requestReplay(fromSeq, toSeq int64) (int, error) {
 	c.mu.RLock()
-	socket := c.replaySocket
+	transport := c.transport
 	c.mu.RUnlock()
 
-	if socket == nil {
-		return fmt.Errorf("replay socket is nil")
+	if transport == nil {
+		return 0, fmt.Errorf("transport is nil")
 	}
 
-	req := make([]byte, 8)
-	binary.BigEndian.PutUint64(req, uint64(fromSeq))
-
-	if _, err := socket.SendBytes(req, 0); err != nil {
-		return fmt.Errorf("failed to send replay request: %w", err)
+	if err := transport.RequestReplay(fromSeq); err != nil {
+		return 0, err
 	}
 
-	// Ideally, we should wait for an ACK here if the protocol supports it
-	// For simplicity in static client, we fire and forget the request,
-	// assuming the server will send the replayed events via the SUB channel (or DEALER response)
-	// Original code read response from DEALER, let's keep that.
+	recovered := 0
+	covered := true
+	for {
+		select {
+		case <-c.ctx.Done():
+			return recovered, c.ctx.Err()
+		default:
+		}
 
-	_ = socket.SetRcvtimeo(c.config.ReplayTimeout)
+		c.bufferLive(transport)
 
-	resp, err := socket.RecvBytes(0)
-	if err != nil {
-		return fmt.Errorf("failed to receive replay response: %w", err)
+		frames, err := transport.RecvReplay(c.config.ReplayTimeout)
+		if err != nil {
+			return recovered, fmt.Errorf("failed to receive replay response: %w", err)
+		}
+		if len(frames) != 2 || len(frames[0]) != 8 {
+			return recovered, fmt.Errorf("malformed replay response: %d frames", len(frames))
+		}
+
+		seq := int64(binary.BigEndian.Uint64(frames[0]))
+		if seq == replayEndSeq {
+			break
+		}
+
+		// The live stream may already have delivered this batch, and batches
+		// past toSeq are left to the live stream. Keep reading until the end
+		// marker so the next request starts from a clean stream.
+		// Without an applied batch the replay must start at fromSeq itself.
+		want := fromSeq
+		if lastSeq := c.getLastSequence(); lastSeq != -1 {
+			want = lastSeq + 1
+		}
+		if seq < want || (toSeq >= 0 && seq > toSeq) || !covered {
+			continue
+		}
+		if seq != want {
+			covered = false
+			continue
+		}
+
+		if recovered == 0 {
+			c.mu.Lock()
+			c.replayFrom = seq
+			c.mu.Unlock()
+		}
+		c.applyMessage(nil, seq, frames[1], false)
+		recovered++
 	}
 
-	slog.Info("Replay requested", "service", c.config.PodKey, "from", fromSeq, "resp_len", len(resp))
-	return nil
+	slog.Info("Replay completed", "service", c.config.PodKey, "from", fromSeq, "recovered", recovered)
+	if !covered {
+		return recovered, errReplayNotCovered
+	}
+	return recovered, nil
 }
 
-func (c *StaticZMQClient) cleanupSockets() {
-	if c.subSocket != nil {
-		c.subSocket.Close()
-		c.subSocket = nil
+func (c *StaticZMQClient) closeTransport() {
+	if c.transport != nil {
+		_ = c.transport.Close()
 	}
-	if c.replaySocket != nil {
-		c.replaySocket.Close()
-		c.replaySocket = nil
-	}
-	c.connected = false
+	c.open = false
+	c.peer.State = ConnectionStateDisconnected
 }
 
-func (c *StaticZMQClient) markDisconnected() {
+func (c *StaticZMQClient) markDisconnected(cause error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.connected = false
+	c.open = false
+	c.lastError = cause.Error()
+}
+
+// Status returns a snapshot of the client's connection and reconnect state.
+func (c *StaticZMQClient) Status() ClientStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	status := ClientStatus{
+		Service:           c.config.PodKey,
+		State:             c.state(),
+		ConnectRetries:    c.peer.Retries,
+		LastSeq:           c.lastSeq,
+		HandledSeq:        c.handledSeq,
+		Duplicates:        c.duplicates,
+		PublisherRestarts: c.restarts,
+		ReconnectAttempts: c.reconnectAttempts,
+		LastError:         c.lastError,
+		NextRetry:         c.nextRetry,
+		Stale:             c.stale,
+		LastMessageAt:     c.lastMessageAt,
+	}
+	c.queue.fillStatus(&status)
+	return status
 }
 
-func (c *StaticZMQClient) isConnected() bool {
+func (c *StaticZMQClient) isOpen() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.connected
+	return c.open
 }
 
 func (c *StaticZMQClient) getLastSequence() int64 {
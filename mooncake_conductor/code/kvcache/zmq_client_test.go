@@ -0,0 +1,365 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient creates an unstarted client on a connected MemoryTransport.
+func newTestClient(t *testing.T, replayCapacity int) (*StaticZMQClient, *MemoryTransport) {
+	t.Helper()
+	config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+	config.ReplayTimeout = 100 * time.Millisecond
+	transport := NewMemoryTransport(16, replayCapacity)
+	if err := transport.Connect(); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	client := NewStaticZMQClient(config, &eventRecorder{}, nil)
+	client.SetTransport(transport)
+	return client, transport
+}
+
+func testPayload(t *testing.T) []byte {
+	t.Helper()
+	payload, err := EncodeEventBatch(&EventBatch{Timestamp: time.Now()})
+	if err != nil {
+		t.Fatalf("failed to encode batch: %v", err)
+	}
+	return payload
+}
+
+func TestReplayFromStart(t *testing.T) {
+	payload := testPayload(t)
+
+	t.Run("covered", func(t *testing.T) {
+		client, transport := newTestClient(t, 8)
+		for seq := int64(0); seq < 3; seq++ {
+			transport.Drop(seq, payload)
+		}
+		recovered, err := client.requestReplay(0, -1)
+		if err != nil || recovered != 3 {
+			t.Fatalf("requestReplay = %d, %v; want 3, nil", recovered, err)
+		}
+		if seq := client.getLastSequence(); seq != 2 {
+			t.Errorf("last sequence = %d, want 2", seq)
+		}
+	})
+
+	// Without an applied batch, a replay that no longer holds fromSeq must
+	// not be taken as a complete recovery
+	t.Run("trimmed", func(t *testing.T) {
+		client, transport := newTestClient(t, 2)
+		for seq := int64(0); seq < 5; seq++ {
+			transport.Drop(seq, payload)
+		}
+		recovered, err := client.requestReplay(0, -1)
+		if !errors.Is(err, errReplayNotCovered) || recovered != 0 {
+			t.Fatalf("requestReplay = %d, %v; want 0, errReplayNotCovered", recovered, err)
+		}
+		if seq := client.getLastSequence(); seq != -1 {
+			t.Errorf("last sequence = %d, want -1", seq)
+		}
+	})
+}
+
+// TestReconnectBackoffNeedsConfirmation checks that connections lost before
+// reaching the publisher keep backing off.
+func TestReconnectBackoffNeedsConfirmation(t *testing.T) {
+	config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+	config.RouterPort = 0
+	config.ReconnectDelay = time.Millisecond
+	config.PollTimeout = 10 * time.Millisecond
+	transport := NewMemoryTransport(16, 16)
+	transport.SetPeerStatus(&PeerStatus{State: ConnectionStateConnecting})
+	client := NewStaticZMQClient(config, &eventRecorder{}, nil)
+	client.SetTransport(transport)
+	if err := client.Start(); err != nil {
+		t.Fatalf("failed to start client: %v", err)
+	}
+	defer client.Stop()
+
+	for n := 1; n <= 3; n++ {
+		waitUntil(t, "the client connects", func() bool { return transport.Connects() == n && transport.Connected() })
+		transport.Disconnect(errors.New("connection reset"))
+	}
+	waitUntil(t, "three reconnect attempts", func() bool { return client.Status().ReconnectAttempts == 3 })
+
+	transport.SetPeerStatus(nil)
+	waitUntil(t, "the peer confirms the connection", func() bool { return client.Status().ReconnectAttempts == 0 })
+	if st := client.Status(); !st.NextRetry.IsZero() {
+		t.Errorf("next retry = %v while connected", st.NextRetry)
+	}
+}
+
+// TestTopicsDisableReplay checks that gaps are not replayed while topics
+// are filtered, since replayed batches could not be filtered.
+func TestTopicsDisableReplay(t *testing.T) {
+	payload := testPayload(t)
+	for _, policy := range []GapPolicy{GapPolicyIgnore, GapPolicyPurge} {
+		t.Run(string(policy), func(t *testing.T) {
+			config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+			config.Topics = []string{"kv"}
+			config.GapPolicy = policy
+			transport := NewMemoryTransport(16, 16)
+			recorder := &eventRecorder{}
+			client := NewStaticZMQClient(config, recorder, nil)
+			client.SetTransport(transport)
+			if err := client.Start(); err != nil {
+				t.Fatalf("failed to start client: %v", err)
+			}
+			defer client.Stop()
+
+			waitUntil(t, "the client connects", transport.Connected)
+			transport.Publish([]byte("kv"), 0, payload)
+			transport.Drop(1, payload) // another topic's batch
+			transport.Publish([]byte("kv"), 2, payload)
+
+			waitUntil(t, "the client reaches seq 2", func() bool { return client.getLastSequence() == 2 })
+			if requests := transport.ReplayRequests(); len(requests) != 0 {
+				t.Errorf("replay requested from %v", requests)
+			}
+			cleared := 0
+			if policy == GapPolicyPurge {
+				cleared = 1
+			}
+			waitUntil(t, "the gap is handled", func() bool { return recorder.count() == cleared })
+		})
+	}
+}
+
+// TestSequenceRegression checks that only batches a replay already applied
+// are duplicates; any other step back is a restarted publisher.
+func TestSequenceRegression(t *testing.T) {
+	payload := testPayload(t)
+	cases := []struct {
+		name        string
+		last        int64
+		replayFrom  int64
+		seq         int64
+		wantRestart bool
+	}{
+		{name: "replayed overlap", last: 1000, replayFrom: 990, seq: 995},
+		{name: "same batch", last: 1000, replayFrom: -1, seq: 1000},
+		{name: "before replay", last: 1000, replayFrom: 990, seq: 989, wantRestart: true},
+		{name: "no replay", last: 1000, replayFrom: -1, seq: 990, wantRestart: true},
+		{name: "near zero", last: 1000, replayFrom: -1, seq: 3, wantRestart: true},
+		{name: "beyond replay", last: 20000, replayFrom: -1, seq: 5000, wantRestart: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+			config.RouterPort = 0
+			client := NewStaticZMQClient(config, &eventRecorder{}, nil)
+			client.lastSeq, client.replayFrom = tc.last, tc.replayFrom
+
+			client.processMessage([][]byte{nil, encodeSeq(tc.seq), payload})
+			status := client.Status()
+			if tc.wantRestart {
+				if status.PublisherRestarts != 1 || status.LastSeq != tc.seq {
+					t.Errorf("restarts = %d, last = %d; want a restart at %d", status.PublisherRestarts, status.LastSeq, tc.seq)
+				}
+				return
+			}
+			if status.PublisherRestarts != 0 || status.Duplicates != 1 || status.LastSeq != tc.last {
+				t.Errorf("restarts = %d, duplicates = %d, last = %d; want a skipped duplicate",
+					status.PublisherRestarts, status.Duplicates, status.LastSeq)
+			}
+		})
+	}
+}
+
+// newResolvingClient creates an unstarted client whose publisher is named
+// by a hostname, resolved by lookup every 10ms.
+func newResolvingClient(t *testing.T, lookup func(ctx context.Context, host string) ([]string, error)) (*StaticZMQClient, *MemoryTransport) {
+	t.Helper()
+	config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+	config.PubEndpoint = "tcp://publisher.test:5557"
+	config.RouterPort = 0
+	config.ReconnectDelay = time.Millisecond
+	config.ResolveInterval = 10 * time.Millisecond
+	transport := NewMemoryTransport(16, 16)
+	client := NewStaticZMQClient(config, &eventRecorder{}, nil)
+	client.SetTransport(transport)
+	client.lookupHost = lookup
+	return client, transport
+}
+
+// TestResolveReconnects checks that the client reconnects when the
+// publisher hostname resolves to other addresses, and only then.
+func TestResolveReconnects(t *testing.T) {
+	var (
+		addrs   atomic.Pointer[[]string]
+		lookups atomic.Int64
+	)
+	addrs.Store(&[]string{"10.0.0.2", "10.0.0.1"})
+	client, transport := newResolvingClient(t, func(_ context.Context, host string) ([]string, error) {
+		if host != "publisher.test" {
+			t.Errorf("resolved %q, want publisher.test", host)
+		}
+		lookups.Add(1)
+		return *addrs.Load(), nil
+	})
+	if err := client.Start(); err != nil {
+		t.Fatalf("failed to start client: %v", err)
+	}
+	defer client.Stop()
+
+	// The same addresses in another order are no change
+	connects := transport.Connects()
+	waitUntil(t, "the hostname was resolved three times", func() bool { return lookups.Load() >= 3 })
+	addrs.Store(&[]string{"10.0.0.1", "10.0.0.2"})
+	waitUntil(t, "the hostname was resolved again", func() bool { return lookups.Load() >= 5 })
+	if got := transport.Connects(); got != connects {
+		t.Fatalf("connected %d times with unchanged addresses, want %d", got, connects)
+	}
+
+	addrs.Store(&[]string{"10.0.0.3"})
+	waitUntil(t, "the client reconnects", func() bool { return transport.Connects() > connects })
+	waitUntil(t, "the client is connected", func() bool { return client.Status().State == ConnectionStateConnected })
+}
+
+// TestResolveDoesNotBlockReading checks that a hanging DNS lookup does not
+// hold up the stream.
+func TestResolveDoesNotBlockReading(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	var lookups atomic.Int64
+	client, transport := newResolvingClient(t, func(ctx context.Context, _ string) ([]string, error) {
+		lookups.Add(1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil, errors.New("lookup timed out")
+	})
+	if err := client.Start(); err != nil {
+		t.Fatalf("failed to start client: %v", err)
+	}
+	defer client.Stop()
+
+	waitUntil(t, "the lookup started", func() bool { return lookups.Load() > 0 })
+	payload := testPayload(t)
+	for seq := int64(0); seq < 3; seq++ {
+		transport.Publish(nil, seq, payload)
+	}
+	waitUntil(t, "the batches are applied", func() bool { return client.getLastSequence() == 2 })
+	if n := lookups.Load(); n != 1 {
+		t.Errorf("%d lookups started, want 1 while the first hangs", n)
+	}
+}
+
+// livenessRecorder is an eventRecorder that also records HandleStale calls
+// and asks for a clear when the stream goes stale if clearOnStale is set.
+type livenessRecorder struct {
+	eventRecorder
+	clearOnStale bool
+
+	staleMu sync.Mutex
+	calls   []bool
+}
+
+func (r *livenessRecorder) HandleStale(stale bool) bool {
+	r.staleMu.Lock()
+	defer r.staleMu.Unlock()
+	r.calls = append(r.calls, stale)
+	return stale && r.clearOnStale
+}
+
+func (r *livenessRecorder) staleCalls() []bool {
+	r.staleMu.Lock()
+	defer r.staleMu.Unlock()
+	return append([]bool(nil), r.calls...)
+}
+
+// TestStaleWatchdog stops publishing past StaleTimeout and checks the
+// stale flag and the handler callbacks, keeping the entries (freeze) or
+// clearing them (drop).
+func TestStaleWatchdog(t *testing.T) {
+	payload := testPayload(t)
+	for _, tc := range []struct {
+		name      string
+		clear     bool
+		wantClear int
+	}{
+		{name: "freeze", clear: false, wantClear: 0},
+		{name: "drop", clear: true, wantClear: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+			config.RouterPort = 0
+			config.StaleTimeout = 50 * time.Millisecond
+			transport := NewMemoryTransport(16, 16)
+			handler := &livenessRecorder{clearOnStale: tc.clear}
+			client := NewStaticZMQClient(config, handler, nil)
+			client.SetTransport(transport)
+			if err := client.Start(); err != nil {
+				t.Fatalf("failed to start client: %v", err)
+			}
+			defer client.Stop()
+
+			transport.Publish(nil, 0, payload)
+			waitUntil(t, "seq 0 is handled", func() bool { return client.Status().HandledSeq == 0 })
+			if client.Status().Stale {
+				t.Fatal("stream stale right after a message")
+			}
+
+			// The publisher goes quiet but stays connected
+			waitUntil(t, "the stream goes stale", func() bool { return client.Status().Stale })
+			if state := client.Status().State; state != ConnectionStateStale {
+				t.Errorf("state = %s, want %s", state, ConnectionStateStale)
+			}
+			waitUntil(t, "the handler is told", func() bool { return len(handler.staleCalls()) == 1 })
+			waitUntil(t, "the clear is handled", func() bool { return countClears(handler.snapshot()) >= tc.wantClear })
+			time.Sleep(2 * config.StaleTimeout)
+			if calls := handler.staleCalls(); len(calls) != 1 || !calls[0] {
+				t.Errorf("HandleStale calls = %v, want [true] once", calls)
+			}
+			if got := countClears(handler.snapshot()); got != tc.wantClear {
+				t.Errorf("%d clears handled while stale, want %d", got, tc.wantClear)
+			}
+
+			// The next message recovers the stream
+			transport.Publish(nil, 1, payload)
+			waitUntil(t, "the stream recovers", func() bool { return !client.Status().Stale })
+			waitUntil(t, "the handler is told", func() bool { return len(handler.staleCalls()) == 2 })
+			if calls := handler.staleCalls(); calls[1] {
+				t.Errorf("HandleStale calls = %v, want [true false]", calls)
+			}
+			if state := client.Status().State; state != ConnectionStateConnected {
+				t.Errorf("state = %s after recovering, want %s", state, ConnectionStateConnected)
+			}
+			if got := countClears(handler.snapshot()); got != tc.wantClear {
+				t.Errorf("%d clears handled after recovering, want %d", got, tc.wantClear)
+			}
+		})
+	}
+}
+
+func countClears(events []KVEvent) int {
+	n := 0
+	for _, event := range events {
+		if _, ok := event.(*AllBlocksClearedEvent); ok {
+			n++
+		}
+	}
+	return n
+}
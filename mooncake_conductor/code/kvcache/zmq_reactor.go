@@ -0,0 +1,260 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build zmq
+// +build zmq
+
+package kvcache
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	zmq "github.com/pebbe/zmq4"
+)
+
+func init() {
+	SetDefaultReactor(NewZMQReactor)
+}
+
+var zmqReactorID atomic.Uint64
+
+// zmqReactor polls the sockets of all idle clients in one zmq.Poller.
+//
+// ZMQ sockets must not be used by two goroutines at once, so a socket is
+// handed to the reactor while its client waits and handed back when it is
+// ready: the reactor then stops polling it before waking the client.
+// Requests reach the reactor through an inproc socket that is part of the
+// poll set, so sockets can be added and removed while it polls.
+type zmqReactor struct {
+	// Requesting side of the wakeup pair, guarded by mu
+	mu       sync.Mutex
+	wake     *zmq.Socket
+	requests []zmqReactorRequest
+	closed   bool
+
+	// Reactor side, only used by run
+	wakeup  *zmq.Socket
+	poller  *zmq.Poller
+	watches map[*zmq.Socket]*zmqWatch
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// zmqWatch is one client waiting for any of its sockets.
+type zmqWatch struct {
+	sockets []*zmq.Socket
+	ready   chan struct{}
+	fired   bool
+}
+
+// zmqReactorRequest adds or removes a watch; done is closed once applied.
+type zmqReactorRequest struct {
+	watch  *zmqWatch
+	remove bool
+	done   chan struct{}
+}
+
+// NewZMQReactor starts a reactor for libzmq transports.
+func NewZMQReactor() (Reactor, error) {
+	addr := fmt.Sprintf("inproc://kvcache-reactor-%d", zmqReactorID.Add(1))
+
+	wakeup, err := zmq.NewSocket(zmq.PAIR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reactor socket: %w", err)
+	}
+	if err := wakeup.Bind(addr); err != nil {
+		_ = wakeup.Close()
+		return nil, fmt.Errorf("failed to bind reactor socket: %w", err)
+	}
+
+	wake, err := zmq.NewSocket(zmq.PAIR)
+	if err != nil {
+		_ = wakeup.Close()
+		return nil, fmt.Errorf("failed to create reactor socket: %w", err)
+	}
+	if err := wake.Connect(addr); err != nil {
+		_ = wake.Close()
+		_ = wakeup.Close()
+		return nil, fmt.Errorf("failed to connect reactor socket: %w", err)
+	}
+
+	r := &zmqReactor{
+		wake:    wake,
+		wakeup:  wakeup,
+		poller:  zmq.NewPoller(),
+		watches: make(map[*zmq.Socket]*zmqWatch),
+		done:    make(chan struct{}),
+	}
+	r.poller.Add(wakeup, zmq.POLLIN)
+	go r.run()
+	return r, nil
+}
+
+// watch hands sockets to the reactor until one of them is readable.
+func (r *zmqReactor) watch(sockets ...*zmq.Socket) (<-chan struct{}, func()) {
+	w := &zmqWatch{sockets: sockets, ready: make(chan struct{})}
+	if err := r.request(zmqReactorRequest{watch: w}); err != nil {
+		// Without the reactor the caller has to poll
+		return nil, nil
+	}
+
+	cancel := func() {
+		done := make(chan struct{})
+		if err := r.request(zmqReactorRequest{watch: w, remove: true, done: done}); err != nil {
+			return
+		}
+		<-done
+	}
+	return w.ready, cancel
+}
+
+// request queues req for the reactor goroutine and wakes it up.
+func (r *zmqReactor) request(req zmqReactorRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return errors.New("reactor is closed")
+	}
+	r.requests = append(r.requests, req)
+	if len(r.requests) == 1 {
+		// A failed send leaves an earlier wakeup pending, which is enough
+		_, _ = r.wake.SendBytes(nil, zmq.DONTWAIT)
+	}
+	return nil
+}
+
+// run polls until Close.
+func (r *zmqReactor) run() {
+	defer close(r.done)
+
+	for {
+		polled, err := r.poller.Poll(-1)
+		if err != nil {
+			if zmq.AsErrno(err) == zmq.Errno(syscall.EINTR) {
+				continue
+			}
+			slog.Error("Reactor poll failed", "error", err)
+			r.shutdown()
+			return
+		}
+
+		for _, p := range polled {
+			if p.Socket == r.wakeup {
+				if !r.applyRequests() {
+					r.shutdown()
+					return
+				}
+				continue
+			}
+			if w := r.watches[p.Socket]; w != nil {
+				r.fire(w)
+			}
+		}
+	}
+}
+
+// applyRequests adds and removes the requested watches. It returns false
+// once the reactor is closed.
+func (r *zmqReactor) applyRequests() bool {
+	for {
+		if _, err := r.wakeup.RecvBytes(zmq.DONTWAIT); err != nil {
+			break
+		}
+	}
+
+	r.mu.Lock()
+	requests := r.requests
+	r.requests = nil
+	closed := r.closed
+	r.mu.Unlock()
+
+	for _, req := range requests {
+		if req.remove {
+			r.unwatch(req.watch)
+		} else {
+			for _, sock := range req.watch.sockets {
+				r.watches[sock] = req.watch
+				r.poller.Add(sock, zmq.POLLIN)
+			}
+		}
+		if req.done != nil {
+			close(req.done)
+		}
+	}
+	return !closed
+}
+
+// fire stops polling the sockets of w and wakes its client.
+func (r *zmqReactor) fire(w *zmqWatch) {
+	r.unwatch(w)
+	if !w.fired {
+		w.fired = true
+		close(w.ready)
+	}
+}
+
+// unwatch stops polling the sockets of w.
+func (r *zmqReactor) unwatch(w *zmqWatch) {
+	for _, sock := range w.sockets {
+		if r.watches[sock] == w {
+			delete(r.watches, sock)
+			_ = r.poller.RemoveBySocket(sock)
+		}
+	}
+}
+
+// shutdown wakes every waiting client, which then polls its own sockets.
+func (r *zmqReactor) shutdown() {
+	r.mu.Lock()
+	r.closed = true
+	requests := r.requests
+	r.requests = nil
+	r.mu.Unlock()
+
+	for _, req := range requests {
+		if !req.remove {
+			r.fire(req.watch)
+		}
+		if req.done != nil {
+			close(req.done)
+		}
+	}
+	for _, w := range r.watches {
+		r.fire(w)
+	}
+}
+
+// Close stops the reactor goroutine and releases its sockets.
+func (r *zmqReactor) Close() error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		_, _ = r.wake.SendBytes(nil, zmq.DONTWAIT)
+	}
+	r.mu.Unlock()
+
+	<-r.done
+	r.closeOnce.Do(func() {
+		_ = r.wake.Close()
+		_ = r.wakeup.Close()
+	})
+	return nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build zmq
+// +build zmq
+
+package kvcache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	zmq "github.com/pebbe/zmq4"
+)
+
+var zmqTestEndpointID atomic.Uint64
+
+// bindZMQ binds a socket of kind to a fresh inproc endpoint.
+func bindZMQ(t testing.TB, kind zmq.Type) (*zmq.Socket, string) {
+	t.Helper()
+	sock, err := zmq.NewSocket(kind)
+	if err != nil {
+		t.Fatalf("failed to create socket: %v", err)
+	}
+	endpoint := fmt.Sprintf("inproc://kvcache-test-%d", zmqTestEndpointID.Add(1))
+	if err := sock.Bind(endpoint); err != nil {
+		_ = sock.Close()
+		t.Fatalf("failed to bind %s: %v", endpoint, err)
+	}
+	t.Cleanup(func() { _ = sock.Close() })
+	return sock, endpoint
+}
+
+func newTestReactor(t testing.TB) *zmqReactor {
+	t.Helper()
+	reactor, err := NewZMQReactor()
+	if err != nil {
+		t.Fatalf("failed to start reactor: %v", err)
+	}
+	t.Cleanup(func() { _ = reactor.Close() })
+	return reactor.(*zmqReactor)
+}
+
+// connectZMQ connects a libzmq transport and waits until it reaches the
+// publisher.
+func connectZMQ(t testing.TB, config *ZMQClientConfig) *zmqTransport {
+	t.Helper()
+	transport := &zmqTransport{config: config}
+	if err := transport.Connect(); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = transport.Close() })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for transport.PeerStatus().State != ConnectionStateConnected {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the publisher")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return transport
+}
+
+func waitReady(t *testing.T, ready <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting until %s", what)
+	}
+}
+
+func assertNotReady(t *testing.T, ready <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ready:
+		t.Fatal("woken without anything to read")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestZMQReactorWakesOnMessage(t *testing.T) {
+	reactor := newTestReactor(t)
+	pub, endpoint := bindZMQ(t, zmq.PUB)
+	config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+	config.PubEndpoint = endpoint
+	config.Reactor = reactor
+	transport := connectZMQ(t, config)
+
+	ready, cancel := transport.Notify()
+	if ready == nil {
+		t.Fatal("transport cannot notify")
+	}
+	assertNotReady(t, ready)
+
+	// The subscription reaches the publisher asynchronously; resend until
+	// the first message gets through
+	payload := []byte("payload")
+	for delivered := false; !delivered; {
+		if _, err := pub.SendMessage("", encodeSeq(0), payload); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+		select {
+		case <-ready:
+			delivered = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+
+	frames, err := transport.Recv(0)
+	if err != nil || len(frames) != 3 || string(frames[2]) != "payload" {
+		t.Fatalf("Recv = %q, %v; want the published message", frames, err)
+	}
+}
+
+// TestZMQReactorWakesOnReplaySocket checks that a stray replay response
+// wakes the client, which then discards it instead of waking again.
+func TestZMQReactorWakesOnReplaySocket(t *testing.T) {
+	reactor := newTestReactor(t)
+	_, pubEndpoint := bindZMQ(t, zmq.PUB)
+	router, replayEndpoint := bindZMQ(t, zmq.ROUTER)
+	config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+	config.PubEndpoint = pubEndpoint
+	config.ReplayEndpoint = replayEndpoint
+	config.Reactor = reactor
+	transport := connectZMQ(t, config)
+
+	if err := transport.RequestReplay(0); err != nil {
+		t.Fatalf("failed to request replay: %v", err)
+	}
+	request, err := router.RecvMessageBytes(0)
+	if err != nil || len(request) != 3 {
+		t.Fatalf("router received %q, %v", request, err)
+	}
+
+	ready, cancel := transport.Notify()
+	assertNotReady(t, ready)
+	if _, err := router.SendMessage(request[0], "", encodeSeq(0), "late"); err != nil {
+		t.Fatalf("failed to send response: %v", err)
+	}
+	waitReady(t, ready, "the replay response arrives")
+	cancel()
+
+	if frames, err := transport.Recv(0); frames != nil || err != nil {
+		t.Fatalf("Recv = %q, %v; want nothing", frames, err)
+	}
+	ready, cancel = transport.Notify()
+	defer cancel()
+	assertNotReady(t, ready)
+}
+
+func TestZMQReactorCancel(t *testing.T) {
+	reactor := newTestReactor(t)
+	pub, endpoint := bindZMQ(t, zmq.PUB)
+	config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+	config.PubEndpoint = endpoint
+	config.Reactor = reactor
+	transport := connectZMQ(t, config)
+
+	// After cancel the reactor no longer polls the sockets, so the client
+	// can read them itself
+	ready, cancel := transport.Notify()
+	cancel()
+	if _, err := pub.SendMessage("", encodeSeq(0), "payload"); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	select {
+	case <-ready:
+		t.Fatal("woken after cancel")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := transport.Recv(10 * time.Millisecond); err != nil {
+		t.Fatalf("Recv after cancel: %v", err)
+	}
+}
+
+func TestZMQReactorClose(t *testing.T) {
+	reactor := newTestReactor(t)
+	_, endpoint := bindZMQ(t, zmq.PUB)
+	config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+	config.PubEndpoint = endpoint
+	config.Reactor = reactor
+	transport := connectZMQ(t, config)
+
+	// Waiting clients are woken and poll from then on
+	ready, cancel := transport.Notify()
+	if err := reactor.Close(); err != nil {
+		t.Fatalf("failed to close reactor: %v", err)
+	}
+	waitReady(t, ready, "the closed reactor wakes the client")
+	cancel()
+
+	if ready, _ := transport.Notify(); ready != nil {
+		t.Error("closed reactor still accepts watches")
+	}
+}
+
+// BenchmarkZMQReactorIdle compares idle clients parked on the libzmq
+// reactor with clients polling their sockets, 200 services on inproc
+// publishers.
+func BenchmarkZMQReactorIdle(b *testing.B) {
+	const services = 200
+	for _, mode := range []string{"reactor", "poll"} {
+		b.Run(fmt.Sprintf("%s/%d_services", mode, services), func(b *testing.B) {
+			var reactor Reactor
+			if mode == "reactor" {
+				reactor = newTestReactor(b)
+			}
+			benchmarkIdle(b, services, reactor, mode == "poll", func(config *ZMQClientConfig) Transport {
+				_, endpoint := bindZMQ(b, zmq.PUB)
+				config.PubEndpoint = endpoint
+				return &zmqTransport{config: config}
+			})
+		})
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build zmq
+// +build zmq
+
+package kvcache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	zmq "github.com/pebbe/zmq4"
+)
+
+func init() {
+	SetDefaultTransport(NewZMQTransport)
+}
+
+// zmqTransport is the libzmq Transport: a SUB socket for the event stream
+// and a DEALER socket talking to the publisher's ROUTER for replays.
+type zmqTransport struct {
+	config *ZMQClientConfig
+
+	subSocket    *zmq.Socket
+	replaySocket *zmq.Socket
+	poller       *zmq.Poller
+
+	// Socket monitors; the replay socket is only monitored with CURVE
+	subMonitor    *zmqMonitor
+	replayMonitor *zmqMonitor
+}
+
+// NewZMQTransport creates a libzmq Transport for config.
+func NewZMQTransport(config *ZMQClientConfig) (Transport, error) {
+	return &zmqTransport{config: config}, nil
+}
+
+// Connect establishes the ZMQ SUB and DEALER sockets.
+func (t *zmqTransport) Connect() error {
+	// Ensure clean state
+	_ = t.Close()
+
+	sock, subMonitor, err := t.openSocket(zmq.SUB, t.config.pubEndpoint(), func(sock *zmq.Socket) error {
+		for _, topic := range subscriptionTopics(t.config) {
+			if err := sock.SetSubscribe(topic); err != nil {
+				return fmt.Errorf("failed to subscribe to %q: %w", topic, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	t.subSocket = sock
+	t.subMonitor = subMonitor
+
+	// Publishers without a replay endpoint only get a SUB socket
+	if endpoint := t.config.replayEndpoint(); endpoint != "" {
+		replaySocket, replayMonitor, err := t.openSocket(zmq.DEALER, endpoint, nil)
+		if err != nil {
+			_ = t.Close()
+			return err
+		}
+		t.replaySocket = replaySocket
+		t.replayMonitor = replayMonitor
+	}
+
+	// Monitor events and stray replay responses wake Recv up too, so the
+	// peer state stays current and a rejected handshake is reported
+	t.poller = zmq.NewPoller()
+	for _, socket := range t.sockets() {
+		t.poller.Add(socket, zmq.POLLIN)
+	}
+	return nil
+}
+
+// sockets returns every socket that can become readable between requests:
+// SUB, DEALER and their monitors.
+func (t *zmqTransport) sockets() []*zmq.Socket {
+	sockets := []*zmq.Socket{t.subSocket, t.subMonitor.socket}
+	if t.replaySocket != nil {
+		sockets = append(sockets, t.replaySocket)
+	}
+	if t.replayMonitor != nil {
+		sockets = append(sockets, t.replayMonitor.socket)
+	}
+	return sockets
+}
+
+// openSocket creates a socket of kind, applies the CURVE keys and setup,
+// and connects it to endpoint. libzmq resolves tcp hostnames on every
+// connect attempt. SUB sockets are always monitored, others only to detect
+// rejected CURVE handshakes.
+func (t *zmqTransport) openSocket(kind zmq.Type, endpoint string, setup func(*zmq.Socket) error) (*zmq.Socket, *zmqMonitor, error) {
+	sock, err := zmq.NewSocket(kind)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create socket failed: %w", err)
+	}
+
+	if err := sock.SetIpv6(true); err != nil {
+		_ = sock.Close()
+		return nil, nil, fmt.Errorf("failed to enable IPv6 on socket: %w", err)
+	}
+
+	if err := t.setHeartbeat(sock); err != nil {
+		_ = sock.Close()
+		return nil, nil, err
+	}
+
+	if keys := t.config.Curve; keys != nil {
+		if err := setCurveKeys(sock, keys); err != nil {
+			_ = sock.Close()
+			return nil, nil, err
+		}
+	}
+
+	var monitor *zmqMonitor
+	if kind == zmq.SUB || t.config.Curve != nil {
+		if monitor, err = newZMQMonitor(sock); err != nil {
+			_ = sock.Close()
+			return nil, nil, err
+		}
+	}
+
+	if setup != nil {
+		if err := setup(sock); err != nil {
+			monitor.close()
+			_ = sock.Close()
+			return nil, nil, err
+		}
+	}
+
+	if err := sock.Connect(endpoint); err != nil {
+		monitor.close()
+		_ = sock.Close()
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", endpoint, err)
+	}
+	return sock, monitor, nil
+}
+
+// setHeartbeat enables ZMTP heartbeats, so libzmq reconnects when the
+// publisher goes silent.
+func (t *zmqTransport) setHeartbeat(sock *zmq.Socket) error {
+	interval, timeout := t.config.HeartbeatInterval, t.config.HeartbeatTimeout
+	if interval <= 0 {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = 3 * interval
+	}
+
+	if err := sock.SetHeartbeatIvl(interval); err != nil {
+		return fmt.Errorf("failed to set heartbeat interval: %w", err)
+	}
+	if err := sock.SetHeartbeatTimeout(timeout); err != nil {
+		return fmt.Errorf("failed to set heartbeat timeout: %w", err)
+	}
+	if err := sock.SetHeartbeatTtl(timeout); err != nil {
+		return fmt.Errorf("failed to set heartbeat TTL: %w", err)
+	}
+	return nil
+}
+
+// setCurveKeys makes sock a CURVE client of the publisher.
+func setCurveKeys(sock *zmq.Socket, keys *CurveKeys) error {
+	if err := sock.SetCurveServerkey(keys.ServerKey); err != nil {
+		return fmt.Errorf("failed to set CURVE server key: %w", err)
+	}
+	if err := sock.SetCurvePublickey(keys.PublicKey); err != nil {
+		return fmt.Errorf("failed to set CURVE public key: %w", err)
+	}
+	if err := sock.SetCurveSecretkey(keys.SecretKey); err != nil {
+		return fmt.Errorf("failed to set CURVE secret key: %w", err)
+	}
+	return nil
+}
+
+// Recv polls the sockets and reads one multipart message from SUB.
+func (t *zmqTransport) Recv(timeout time.Duration) ([][]byte, error) {
+	if t.subSocket == nil {
+		return nil, ErrTransportClosed
+	}
+
+	polled, err := t.poller.Poll(timeout)
+	if err != nil {
+		return nil, fmt.Errorf("poll error: %w", err)
+	}
+	for _, p := range polled {
+		switch p.Socket {
+		case t.subSocket:
+			return t.subSocket.RecvMessageBytes(0)
+		case t.replaySocket:
+			// Left over from a replay that timed out
+			t.discardReplies()
+		}
+	}
+	// libzmq retries rejected handshakes silently; report them instead
+	if err := t.subMonitor.rejected(); err != nil {
+		return nil, err
+	}
+	return nil, t.replayMonitor.rejected()
+}
+
+// RequestReplay sends vLLM's replay request: the ROUTER expects
+// [identity, "", start_seq], and the identity is added by ZMQ.
+func (t *zmqTransport) RequestReplay(fromSeq int64) error {
+	if t.replaySocket == nil {
+		return fmt.Errorf("replay socket is nil")
+	}
+	if err := t.replayMonitor.rejected(); err != nil {
+		return err
+	}
+
+	t.discardReplies()
+
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint64(req, uint64(fromSeq))
+	if _, err := t.replaySocket.SendMessage([]byte{}, req); err != nil {
+		return fmt.Errorf("failed to send replay request: %w", err)
+	}
+	return nil
+}
+
+// discardReplies drops responses left over from an earlier replay request
+// that timed out.
+func (t *zmqTransport) discardReplies() {
+	for {
+		if _, err := t.replaySocket.RecvMessageBytes(zmq.DONTWAIT); err != nil {
+			return
+		}
+	}
+}
+
+// RecvReplay reads one replay response and strips its empty delimiter frame.
+func (t *zmqTransport) RecvReplay(timeout time.Duration) ([][]byte, error) {
+	if t.replaySocket == nil {
+		return nil, fmt.Errorf("replay socket is nil")
+	}
+	if err := t.replaySocket.SetRcvtimeo(timeout); err != nil {
+		return nil, fmt.Errorf("failed to set replay timeout: %w", err)
+	}
+
+	frames, err := t.replaySocket.RecvMessageBytes(0)
+	if err != nil {
+		if rejected := t.replayMonitor.rejected(); rejected != nil {
+			return nil, rejected
+		}
+		return nil, err
+	}
+	if len(frames) > 0 && len(frames[0]) == 0 {
+		frames = frames[1:]
+	}
+	return frames, nil
+}
+
+// Notify implements Notifier through the reactor in the config; without
+// one the transport has to be polled.
+func (t *zmqTransport) Notify() (<-chan struct{}, func()) {
+	reactor, ok := t.config.Reactor.(*zmqReactor)
+	if !ok || t.subSocket == nil {
+		return nil, nil
+	}
+	return reactor.watch(t.sockets()...)
+}
+
+// PeerStatus implements Transport from the SUB socket's monitor events.
+func (t *zmqTransport) PeerStatus() PeerStatus {
+	if t.subMonitor == nil {
+		return PeerStatus{State: ConnectionStateDisconnected}
+	}
+	t.subMonitor.update()
+	return t.subMonitor.peer
+}
+
+// Close closes both sockets.
+func (t *zmqTransport) Close() error {
+	if t.subSocket != nil {
+		t.subSocket.Close()
+		t.subSocket = nil
+	}
+	if t.replaySocket != nil {
+		t.replaySocket.Close()
+		t.replaySocket = nil
+	}
+	t.subMonitor.close()
+	t.replayMonitor.close()
+	t.subMonitor, t.replayMonitor = nil, nil
+	t.poller = nil
+	return nil
+}
+
+// zmqHandshakeFailures are the monitor events of a failed handshake
+const zmqHandshakeFailures = zmq.EVENT_HANDSHAKE_FAILED_NO_DETAIL |
+	zmq.EVENT_HANDSHAKE_FAILED_PROTOCOL |
+	zmq.EVENT_HANDSHAKE_FAILED_AUTH
+
+// zmqMonitorEvents are the monitor events that change the peer state
+const zmqMonitorEvents = zmq.EVENT_CONNECT_RETRIED |
+	zmq.EVENT_HANDSHAKE_SUCCEEDED |
+	zmq.EVENT_DISCONNECTED |
+	zmqHandshakeFailures
+
+var zmqMonitorID atomic.Uint64
+
+// zmqMonitor follows the connection of a socket to the publisher through
+// its monitor events. libzmq connects and reconnects in the background,
+// so the socket itself cannot tell whether the publisher is reachable.
+type zmqMonitor struct {
+	socket    *zmq.Socket
+	peer      PeerStatus
+	rejection error // Handshake failure not yet reported by rejected
+}
+
+func newZMQMonitor(sock *zmq.Socket) (*zmqMonitor, error) {
+	addr := fmt.Sprintf("inproc://kvcache-monitor-%d", zmqMonitorID.Add(1))
+	if err := sock.Monitor(addr, zmqMonitorEvents); err != nil {
+		return nil, fmt.Errorf("failed to monitor socket: %w", err)
+	}
+
+	pair, err := zmq.NewSocket(zmq.PAIR)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create monitor socket: %w", err)
+	}
+	if err := pair.Connect(addr); err != nil {
+		_ = pair.Close()
+		return nil, fmt.Errorf("failed to connect monitor socket: %w", err)
+	}
+	return &zmqMonitor{
+		socket: pair,
+		peer:   PeerStatus{State: ConnectionStateConnecting},
+	}, nil
+}
+
+// update applies the events received since the last call. It does not block.
+func (m *zmqMonitor) update() {
+	for {
+		event, addr, _, err := m.socket.RecvEvent(zmq.DONTWAIT)
+		if err != nil {
+			return
+		}
+		m.apply(event, addr)
+	}
+}
+
+// apply moves the peer state on for one monitor event from addr.
+func (m *zmqMonitor) apply(event zmq.Event, addr string) {
+	switch {
+	case event == zmq.EVENT_HANDSHAKE_SUCCEEDED:
+		m.peer = PeerStatus{State: ConnectionStateConnected}
+	case event == zmq.EVENT_DISCONNECTED:
+		m.peer.State = ConnectionStateDisconnected
+	case event == zmq.EVENT_CONNECT_RETRIED:
+		m.peer.State = ConnectionStateConnecting
+		m.peer.Retries++
+	case event&zmqHandshakeFailures != 0:
+		m.peer.State = ConnectionStateDisconnected
+		m.rejection = fmt.Errorf("%w: %s at %s", ErrHandshakeRejected, event, addr)
+	}
+}
+
+// rejected reports a handshake failure seen since the last call. It does
+// not block and is a no-op on a nil monitor.
+func (m *zmqMonitor) rejected() error {
+	if m == nil {
+		return nil
+	}
+	m.update()
+	err := m.rejection
+	m.rejection = nil
+	return err
+}
+
+func (m *zmqMonitor) close() {
+	if m != nil {
+		_ = m.socket.Close()
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build zmq
+// +build zmq
+
+package kvcache
+
+import (
+	"errors"
+	"testing"
+
+	zmq "github.com/pebbe/zmq4"
+)
+
+// TestZMQMonitorEvents feeds synthetic monitor events to a zmqMonitor and
+// checks the peer state and rejections it derives.
+func TestZMQMonitorEvents(t *testing.T) {
+	cases := []struct {
+		name         string
+		events       []zmq.Event
+		want         PeerStatus
+		wantRejected bool
+	}{
+		{
+			name: "no events",
+			want: PeerStatus{State: ConnectionStateConnecting},
+		},
+		{
+			// A tcp connection alone does not reach the publisher yet
+			name:   "connected without handshake",
+			events: []zmq.Event{zmq.EVENT_CONNECTED},
+			want:   PeerStatus{State: ConnectionStateConnecting},
+		},
+		{
+			name:   "handshake succeeded",
+			events: []zmq.Event{zmq.EVENT_CONNECTED, zmq.EVENT_HANDSHAKE_SUCCEEDED},
+			want:   PeerStatus{State: ConnectionStateConnected},
+		},
+		{
+			name:   "retried",
+			events: []zmq.Event{zmq.EVENT_CONNECT_RETRIED, zmq.EVENT_CONNECT_RETRIED},
+			want:   PeerStatus{State: ConnectionStateConnecting, Retries: 2},
+		},
+		{
+			// Reaching the publisher resets the retries
+			name:   "retried then connected",
+			events: []zmq.Event{zmq.EVENT_CONNECT_RETRIED, zmq.EVENT_HANDSHAKE_SUCCEEDED},
+			want:   PeerStatus{State: ConnectionStateConnected},
+		},
+		{
+			name:   "disconnected",
+			events: []zmq.Event{zmq.EVENT_HANDSHAKE_SUCCEEDED, zmq.EVENT_DISCONNECTED},
+			want:   PeerStatus{State: ConnectionStateDisconnected},
+		},
+		{
+			name:   "disconnected then retried",
+			events: []zmq.Event{zmq.EVENT_HANDSHAKE_SUCCEEDED, zmq.EVENT_DISCONNECTED, zmq.EVENT_CONNECT_RETRIED},
+			want:   PeerStatus{State: ConnectionStateConnecting, Retries: 1},
+		},
+		{
+			name:         "authentication failed",
+			events:       []zmq.Event{zmq.EVENT_CONNECTED, zmq.EVENT_HANDSHAKE_FAILED_AUTH},
+			want:         PeerStatus{State: ConnectionStateDisconnected},
+			wantRejected: true,
+		},
+		{
+			name:         "protocol error",
+			events:       []zmq.Event{zmq.EVENT_HANDSHAKE_FAILED_PROTOCOL},
+			want:         PeerStatus{State: ConnectionStateDisconnected},
+			wantRejected: true,
+		},
+		{
+			// The rejection is kept until reported, even once retrying
+			name:         "failed then retried",
+			events:       []zmq.Event{zmq.EVENT_HANDSHAKE_FAILED_NO_DETAIL, zmq.EVENT_CONNECT_RETRIED},
+			want:         PeerStatus{State: ConnectionStateConnecting, Retries: 1},
+			wantRejected: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			monitor := &zmqMonitor{peer: PeerStatus{State: ConnectionStateConnecting}}
+			for _, event := range tc.events {
+				monitor.apply(event, "tcp://127.0.0.1:5557")
+			}
+			if monitor.peer != tc.want {
+				t.Errorf("peer = %+v, want %+v", monitor.peer, tc.want)
+			}
+			if rejected := errors.Is(monitor.rejection, ErrHandshakeRejected); rejected != tc.wantRejected {
+				t.Errorf("rejection = %v, want rejected %v", monitor.rejection, tc.wantRejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,641 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !zmq
+// +build !zmq
+
+package kvcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// ZMTP 3.0 framing, see https://rfc.zeromq.org/spec/23/
+const (
+	zmtpGreetingSize = 64
+	zmtpMajorVersion = 3
+	// Version 3.0 peers subscribe with a message frame rather than the 3.1
+	// SUBSCRIBE command, which every 3.x publisher accepts
+	zmtpMinorVersion = 0
+
+	zmtpFlagMore    = 0x01
+	zmtpFlagLong    = 0x02
+	zmtpFlagCommand = 0x04
+
+	zmtpMechanismNull  = "NULL"
+	zmtpMechanismCurve = "CURVE"
+
+	zmtpSocketSub    = "SUB"
+	zmtpSocketDealer = "DEALER"
+
+	// zmtpMaxFrameSize guards against garbage length prefixes
+	zmtpMaxFrameSize = 256 << 20
+
+	zmtpHandshakeTimeout = 10 * time.Second
+	zmtpReconnectDelay   = 100 * time.Millisecond // libzmq's ZMQ_RECONNECT_IVL
+)
+
+// zmtpPeers lists the socket types each local socket type may talk to
+var zmtpPeers = map[string][]string{
+	zmtpSocketSub:    {"PUB", "XPUB"},
+	zmtpSocketDealer: {"ROUTER", "DEALER"},
+}
+
+// zmtpOptions configures a zmtpSocket.
+type zmtpOptions struct {
+	topics    []string   // SUB only
+	keys      *curveKeys // nil for the NULL mechanism
+	queueSize int
+
+	// Heartbeats, disabled when heartbeatInterval is zero; the connection
+	// is dropped when nothing arrives within heartbeatTimeout
+	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration
+}
+
+// zmtpSocket is a minimal connecting ZMTP 3.x socket. Like a libzmq socket
+// it dials in the background and redials whenever the connection drops;
+// received messages are queued until read.
+type zmtpSocket struct {
+	socketType string
+	network    string // net.Dial network, "tcp" or "unix"
+	endpoint   string
+	zmtpOptions
+
+	incoming chan [][]byte
+	failed   chan error    // Handshake rejections, reported by recv and send
+	signal   chan struct{} // Set whenever recv may have something new
+	closed   chan struct{}
+	wg       sync.WaitGroup
+
+	mu   sync.Mutex
+	conn *zmtpConn
+	peer PeerStatus
+}
+
+// newZMTPSocket starts connecting a socket of socketType to endpoint, a
+// net.Dial address on network. SUB sockets subscribe to the given topic
+// prefixes. With keys, the socket is a CURVE client.
+func newZMTPSocket(socketType, network, endpoint string, options zmtpOptions) *zmtpSocket {
+	s := &zmtpSocket{
+		socketType:  socketType,
+		network:     network,
+		endpoint:    endpoint,
+		zmtpOptions: options,
+		incoming:    make(chan [][]byte, options.queueSize),
+		failed:      make(chan error, 1),
+		signal:      make(chan struct{}, 1),
+		closed:      make(chan struct{}),
+		peer:        PeerStatus{State: ConnectionStateConnecting},
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+// recv returns the next message, or nil if none arrives within timeout.
+// A zero timeout does not wait.
+func (s *zmtpSocket) recv(timeout time.Duration) ([][]byte, error) {
+	if timeout <= 0 {
+		select {
+		case msg := <-s.incoming:
+			return msg, nil
+		case err := <-s.failed:
+			return nil, err
+		case <-s.closed:
+			return nil, ErrTransportClosed
+		default:
+			return nil, nil
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case msg := <-s.incoming:
+		return msg, nil
+	case err := <-s.failed:
+		return nil, err
+	case <-s.closed:
+		return nil, ErrTransportClosed
+	case <-timer.C:
+		return nil, nil
+	}
+}
+
+// drain discards queued messages.
+func (s *zmtpSocket) drain() {
+	for {
+		select {
+		case <-s.incoming:
+		default:
+			return
+		}
+	}
+}
+
+// send writes a multipart message to the current connection.
+func (s *zmtpSocket) send(frames ...[]byte) error {
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+
+	if conn == nil {
+		select {
+		case err := <-s.failed:
+			return err
+		default:
+		}
+		return fmt.Errorf("not connected to %s", s.endpoint)
+	}
+	return conn.writeMessage(frames)
+}
+
+// notify returns a channel that is readable once recv may not block.
+func (s *zmtpSocket) notify() <-chan struct{} {
+	if len(s.incoming) > 0 || len(s.failed) > 0 {
+		return readyNow
+	}
+	return s.signal
+}
+
+// wake sets the notify signal.
+func (s *zmtpSocket) wake() {
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// status returns the state of the connection to the peer.
+func (s *zmtpSocket) status() PeerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peer
+}
+
+// lost records the end of a session: a dropped connection is reported as
+// disconnected, a failed attempt as a retry.
+func (s *zmtpSocket) lost() {
+	defer s.wake()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.peer.State == ConnectionStateConnected {
+		s.peer.State = ConnectionStateDisconnected
+		return
+	}
+	s.peer.State = ConnectionStateConnecting
+	s.peer.Retries++
+}
+
+// close stops the socket and waits for its goroutine.
+func (s *zmtpSocket) close() {
+	select {
+	case <-s.closed:
+		return
+	default:
+	}
+	close(s.closed)
+
+	s.mu.Lock()
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// run dials, handshakes and reads until the socket is closed.
+func (s *zmtpSocket) run() {
+	defer s.wg.Done()
+
+	for {
+		err := s.session()
+		select {
+		case <-s.closed:
+			return
+		default:
+		}
+
+		if errors.Is(err, ErrHandshakeRejected) {
+			// Keep only the latest rejection for the reader
+			select {
+			case <-s.failed:
+			default:
+			}
+			s.failed <- err
+			s.wake()
+		}
+		s.lost()
+		slog.Debug("ZMTP connection lost", "endpoint", s.endpoint, "socket", s.socketType, "error", err)
+
+		select {
+		case <-s.closed:
+			return
+		case <-time.After(zmtpReconnectDelay):
+		}
+	}
+}
+
+// session runs one connection from dial to failure. Hostnames are
+// resolved on every dial.
+func (s *zmtpSocket) session() error {
+	netConn, err := net.DialTimeout(s.network, s.endpoint, zmtpHandshakeTimeout)
+	if err != nil {
+		return err
+	}
+	conn := &zmtpConn{
+		Conn:   netConn,
+		reader: bufio.NewReader(netConn),
+	}
+	defer conn.Close()
+
+	// Without PINGs an idle publisher sends nothing at all, so silence only
+	// means a dead peer while heartbeats are enabled
+	if s.heartbeatInterval > 0 {
+		conn.readTimeout = s.heartbeatTimeout
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(zmtpHandshakeTimeout))
+	if err := s.handshake(conn); err != nil {
+		return fmt.Errorf("ZMTP handshake with %s failed: %w", s.endpoint, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	// A 3.0 subscription is a message of 0x01 followed by the topic prefix
+	for _, topic := range s.topics {
+		if err := conn.writeMessage([][]byte{append([]byte{0x01}, topic...)}); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	select {
+	case <-s.closed:
+		s.mu.Unlock()
+		return ErrTransportClosed
+	default:
+	}
+	s.conn = conn
+	s.peer = PeerStatus{State: ConnectionStateConnected}
+	s.mu.Unlock()
+	s.wake()
+
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		s.mu.Lock()
+		s.conn = nil
+		s.mu.Unlock()
+	}()
+
+	if s.heartbeatInterval > 0 {
+		go conn.heartbeat(s.heartbeatInterval, s.heartbeatTimeout, done)
+	}
+
+	for {
+		msg, err := conn.readMessage()
+		if err != nil {
+			return err
+		}
+		select {
+		case s.incoming <- msg:
+			s.wake()
+		case <-s.closed:
+			return ErrTransportClosed
+		}
+	}
+}
+
+// handshake exchanges greetings and runs the security mechanism.
+func (s *zmtpSocket) handshake(conn *zmtpConn) error {
+	mechanism := zmtpMechanismNull
+	if s.keys != nil {
+		mechanism = zmtpMechanismCurve
+	}
+
+	greeting := make([]byte, zmtpGreetingSize)
+	greeting[0] = 0xff
+	greeting[9] = 0x7f
+	greeting[10] = zmtpMajorVersion
+	greeting[11] = zmtpMinorVersion
+	copy(greeting[12:32], mechanism)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+
+	peer := make([]byte, zmtpGreetingSize)
+	if _, err := io.ReadFull(conn.reader, peer); err != nil {
+		return fmt.Errorf("failed to read greeting: %w", err)
+	}
+	if peer[0] != 0xff || peer[9]&0x01 != 0x01 {
+		return errors.New("peer is not a ZMTP endpoint")
+	}
+	if peer[10] < zmtpMajorVersion {
+		return fmt.Errorf("unsupported ZMTP version %d.%d", peer[10], peer[11])
+	}
+	if peerMechanism := string(bytes.TrimRight(peer[12:32], "\x00")); peerMechanism != mechanism {
+		return fmt.Errorf("%w: publisher uses the %s mechanism, client uses %s",
+			ErrHandshakeRejected, peerMechanism, mechanism)
+	}
+
+	metadata := map[string]string{"Socket-Type": s.socketType}
+	var props map[string]string
+	var err error
+	if s.keys != nil {
+		props, err = curveHandshake(conn, s.keys, metadata)
+	} else {
+		props, err = nullHandshake(conn, metadata)
+	}
+	if err != nil {
+		return err
+	}
+
+	peerType := props["Socket-Type"]
+	for _, allowed := range zmtpPeers[s.socketType] {
+		if peerType == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s socket cannot talk to %s", s.socketType, peerType)
+}
+
+// nullHandshake exchanges READY commands and returns the peer's metadata.
+func nullHandshake(conn *zmtpConn, metadata map[string]string) (map[string]string, error) {
+	if err := conn.writeFrame(zmtpCommand("READY", metadata), zmtpFlagCommand); err != nil {
+		return nil, err
+	}
+
+	name, data, err := conn.readCommand()
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "READY":
+		return parseProperties(data)
+	case "ERROR":
+		return nil, fmt.Errorf("%w: %s", ErrHandshakeRejected, zmtpErrorReason(data))
+	default:
+		return nil, fmt.Errorf("unexpected %s command during handshake", name)
+	}
+}
+
+// zmtpConn is one established connection. With CURVE, every frame after
+// the handshake travels inside an encrypted MESSAGE.
+type zmtpConn struct {
+	net.Conn
+	reader *bufio.Reader
+	curve  *curveSession // nil for the NULL mechanism
+
+	// readTimeout drops the connection when the peer goes silent, including
+	// its PONG replies; zero waits forever
+	readTimeout time.Duration
+
+	writeMu sync.Mutex
+}
+
+// heartbeat sends a PING every interval until done is closed. The TTL asks
+// the peer to drop the connection if our PINGs stop for ttl.
+func (c *zmtpConn) heartbeat(interval, ttl time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// The TTL is sent in deciseconds
+	deciseconds := ttl / (100 * time.Millisecond)
+	if deciseconds > 0xffff {
+		deciseconds = 0xffff
+	}
+	ping := binary.BigEndian.AppendUint16([]byte("\x04PING"), uint16(deciseconds))
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.writeFrame(ping, zmtpFlagCommand); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readMessage reads the frames of the next message, answering heartbeats
+// on the way.
+func (c *zmtpConn) readMessage() ([][]byte, error) {
+	var msg [][]byte
+	for {
+		flags, body, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		if flags&zmtpFlagCommand != 0 {
+			if err := c.handleCommand(body); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		msg = append(msg, body)
+		if flags&zmtpFlagMore == 0 {
+			return msg, nil
+		}
+	}
+}
+
+// handleCommand handles a command received after the handshake.
+func (c *zmtpConn) handleCommand(body []byte) error {
+	name, data, err := splitCommand(body)
+	if err != nil {
+		return err
+	}
+	switch name {
+	case "PING":
+		// PING carries a 2-byte TTL followed by a context echoed in PONG
+		if len(data) >= 2 {
+			data = data[2:]
+		}
+		return c.writeFrame(append([]byte("\x04PONG"), data...), zmtpFlagCommand)
+	case "ERROR":
+		return fmt.Errorf("peer sent ERROR: %s", zmtpErrorReason(data))
+	}
+	// PONG and commands this socket does not use are ignored
+	return nil
+}
+
+// writeMessage writes the frames of one message.
+func (c *zmtpConn) writeMessage(frames [][]byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	w := bufio.NewWriter(c.Conn)
+	for i, frame := range frames {
+		var flags byte
+		if i < len(frames)-1 {
+			flags = zmtpFlagMore
+		}
+		c.bufferFrame(w, frame, flags)
+	}
+	return w.Flush()
+}
+
+// writeFrame writes a single frame.
+func (c *zmtpConn) writeFrame(body []byte, flags byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	w := bufio.NewWriter(c.Conn)
+	c.bufferFrame(w, body, flags)
+	return w.Flush()
+}
+
+// bufferFrame writes a frame to w, encrypting it once CURVE is established.
+func (c *zmtpConn) bufferFrame(w *bufio.Writer, body []byte, flags byte) {
+	if c.curve != nil {
+		body = c.curve.encrypt(body, flags)
+		flags = 0
+	}
+	if len(body) > 255 {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(body)))
+		_ = w.WriteByte(flags | zmtpFlagLong)
+		_, _ = w.Write(n[:])
+	} else {
+		_ = w.WriteByte(flags)
+		_ = w.WriteByte(byte(len(body)))
+	}
+	_, _ = w.Write(body)
+}
+
+// readFrame reads one frame, decrypting it once CURVE is established.
+func (c *zmtpConn) readFrame() (byte, []byte, error) {
+	if c.readTimeout > 0 {
+		_ = c.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	flags, body, err := readFrame(c.reader)
+	if err != nil || c.curve == nil {
+		return flags, body, err
+	}
+	return c.curve.decrypt(body)
+}
+
+// readCommand reads a handshake command and splits it into name and data.
+func (c *zmtpConn) readCommand() (string, []byte, error) {
+	flags, body, err := readFrame(c.reader)
+	if err != nil {
+		return "", nil, err
+	}
+	if flags&zmtpFlagCommand == 0 {
+		return "", nil, errors.New("expected a command frame")
+	}
+	return splitCommand(body)
+}
+
+// readFrame reads one raw frame and returns its flags and body.
+func readFrame(reader *bufio.Reader) (byte, []byte, error) {
+	flags, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var size uint64
+	if flags&zmtpFlagLong != 0 {
+		var n [8]byte
+		if _, err := io.ReadFull(reader, n[:]); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(n[:])
+	} else {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(b)
+	}
+	if size > zmtpMaxFrameSize {
+		return 0, nil, fmt.Errorf("frame of %d bytes exceeds limit", size)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+// zmtpCommand encodes a command body with metadata properties.
+func zmtpCommand(name string, props map[string]string) []byte {
+	buf := []byte{byte(len(name))}
+	buf = append(buf, name...)
+	return appendProperties(buf, props)
+}
+
+// appendProperties appends ZMTP metadata properties to buf.
+func appendProperties(buf []byte, props map[string]string) []byte {
+	for key, value := range props {
+		buf = append(buf, byte(len(key)))
+		buf = append(buf, key...)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+		buf = append(buf, value...)
+	}
+	return buf
+}
+
+// splitCommand splits a command body into its name and data.
+func splitCommand(body []byte) (string, []byte, error) {
+	if len(body) < 1 || len(body) < 1+int(body[0]) {
+		return "", nil, errors.New("malformed command")
+	}
+	return string(body[1 : 1+body[0]]), body[1+body[0]:], nil
+}
+
+// parseProperties decodes ZMTP metadata properties.
+func parseProperties(data []byte) (map[string]string, error) {
+	props := make(map[string]string)
+	for len(data) > 0 {
+		keyLen := int(data[0])
+		if len(data) < 1+keyLen+4 {
+			return nil, errors.New("malformed command property")
+		}
+		key := string(data[1 : 1+keyLen])
+		valueLen := int(binary.BigEndian.Uint32(data[1+keyLen:]))
+		data = data[1+keyLen+4:]
+		if len(data) < valueLen {
+			return nil, errors.New("malformed command property")
+		}
+		props[key] = string(data[:valueLen])
+		data = data[valueLen:]
+	}
+	return props, nil
+}
+
+// zmtpErrorReason returns the reason string carried by an ERROR command.
+func zmtpErrorReason(data []byte) string {
+	if len(data) > 0 && len(data) >= 1+int(data[0]) && data[0] > 0 {
+		return string(data[1 : 1+data[0]])
+	}
+	return "no reason given"
+}
@@ -0,0 +1,239 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !zmq
+// +build !zmq
+
+package kvcache
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// CurveZMQ client handshake and message encryption, see
+// https://rfc.zeromq.org/spec/26/
+
+// curveKeys holds the decoded keys of a CURVE client.
+type curveKeys struct {
+	server [32]byte
+	public [32]byte
+	secret [32]byte
+}
+
+// decodeCurveKeys decodes Z85 keys; nil keys select the NULL mechanism.
+func decodeCurveKeys(keys *CurveKeys) (*curveKeys, error) {
+	if keys == nil {
+		return nil, nil
+	}
+	if err := keys.Validate(); err != nil {
+		return nil, err
+	}
+
+	decoded := &curveKeys{}
+	for _, key := range []struct {
+		dst *[32]byte
+		src string
+	}{
+		{&decoded.server, keys.ServerKey},
+		{&decoded.public, keys.PublicKey},
+		{&decoded.secret, keys.SecretKey},
+	} {
+		b, _ := z85Decode(key.src)
+		copy(key.dst[:], b)
+	}
+	return decoded, nil
+}
+
+// curveSession encrypts and decrypts MESSAGE commands with the transient
+// keys agreed on in the handshake.
+type curveSession struct {
+	shared    [32]byte
+	nonce     uint64 // Last short nonce sent
+	peerNonce uint64 // Last short nonce received
+}
+
+// curveHandshake runs HELLO/WELCOME/INITIATE/READY as a client, installs
+// the session on conn and returns the publisher's metadata.
+func curveHandshake(conn *zmtpConn, keys *curveKeys, metadata map[string]string) (map[string]string, error) {
+	// Transient key pair for this connection only
+	transientPublic, transientSecret, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CURVE key pair: %w", err)
+	}
+	session := &curveSession{}
+
+	// HELLO: version, anti-amplification padding, C', short nonce and
+	// Box[64 zero bytes](C'->S)
+	hello := make([]byte, 0, 200)
+	hello = append(hello, "\x05HELLO\x01\x00"...)
+	hello = append(hello, make([]byte, 72)...)
+	hello = append(hello, transientPublic[:]...)
+	hello = appendCurveNonce(hello, session.nextNonce())
+	nonce := curveNonce("CurveZMQHELLO---", session.nonce)
+	hello = box.Seal(hello, make([]byte, 64), &nonce, &keys.server, transientSecret)
+	if err := conn.writeFrame(hello, zmtpFlagCommand); err != nil {
+		return nil, err
+	}
+
+	// WELCOME: long nonce and Box[S' + cookie](S->C')
+	welcome, err := readCurveCommand(conn, "WELCOME")
+	if err != nil {
+		return nil, err
+	}
+	if len(welcome) != 16+144 {
+		return nil, fmt.Errorf("malformed WELCOME of %d bytes", len(welcome))
+	}
+	var longNonce [24]byte
+	copy(longNonce[:], "WELCOME-")
+	copy(longNonce[8:], welcome[:16])
+	plain, ok := box.Open(nil, welcome[16:], &longNonce, &keys.server, transientSecret)
+	if !ok {
+		return nil, fmt.Errorf("%w: WELCOME does not match the configured server key", ErrHandshakeRejected)
+	}
+	var serverTransient [32]byte
+	copy(serverTransient[:], plain[:32])
+	cookie := plain[32:128]
+
+	// INITIATE: cookie, short nonce and Box[C + vouch + metadata](C'->S'),
+	// where the vouch Box[C' + S](C->S') proves we hold the long-term key
+	var vouchNonce [24]byte
+	copy(vouchNonce[:], "VOUCH---")
+	if _, err := io.ReadFull(rand.Reader, vouchNonce[8:]); err != nil {
+		return nil, err
+	}
+	vouchPlain := append(append([]byte{}, transientPublic[:]...), keys.server[:]...)
+	vouch := box.Seal(nil, vouchPlain, &vouchNonce, &serverTransient, &keys.secret)
+
+	initiatePlain := append([]byte{}, keys.public[:]...)
+	initiatePlain = append(initiatePlain, vouchNonce[8:]...)
+	initiatePlain = append(initiatePlain, vouch...)
+	initiatePlain = appendProperties(initiatePlain, metadata)
+
+	initiate := append([]byte("\x08INITIATE"), cookie...)
+	initiate = appendCurveNonce(initiate, session.nextNonce())
+	nonce = curveNonce("CurveZMQINITIATE", session.nonce)
+	initiate = box.Seal(initiate, initiatePlain, &nonce, &serverTransient, transientSecret)
+	if err := conn.writeFrame(initiate, zmtpFlagCommand); err != nil {
+		return nil, err
+	}
+
+	// READY: short nonce and Box[metadata](S'->C')
+	ready, err := readCurveCommand(conn, "READY")
+	if err != nil {
+		return nil, err
+	}
+	if len(ready) < 8+box.Overhead {
+		return nil, fmt.Errorf("malformed READY of %d bytes", len(ready))
+	}
+	session.peerNonce = binary.BigEndian.Uint64(ready[:8])
+	nonce = curveNonce("CurveZMQREADY---", session.peerNonce)
+	props, ok := box.Open(nil, ready[8:], &nonce, &serverTransient, transientSecret)
+	if !ok {
+		return nil, errors.New("failed to decrypt READY")
+	}
+
+	box.Precompute(&session.shared, &serverTransient, transientSecret)
+	conn.curve = session
+	return parseProperties(props)
+}
+
+// readCurveCommand reads the expected handshake command and returns its
+// data. An ERROR or a closed connection means the publisher rejected us.
+func readCurveCommand(conn *zmtpConn, expected string) ([]byte, error) {
+	name, data, err := conn.readCommand()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("%w: connection closed during CURVE handshake, check the server key", ErrHandshakeRejected)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case expected:
+		return data, nil
+	case "ERROR":
+		return nil, fmt.Errorf("%w: %s", ErrHandshakeRejected, zmtpErrorReason(data))
+	default:
+		return nil, fmt.Errorf("expected %s, got %s during CURVE handshake", expected, name)
+	}
+}
+
+// encrypt wraps one frame into a MESSAGE command.
+func (s *curveSession) encrypt(frame []byte, flags byte) []byte {
+	plain := make([]byte, 0, 1+len(frame))
+	var messageFlags byte
+	if flags&zmtpFlagMore != 0 {
+		messageFlags |= 0x01
+	}
+	if flags&zmtpFlagCommand != 0 {
+		messageFlags |= 0x02
+	}
+	plain = append(plain, messageFlags)
+	plain = append(plain, frame...)
+
+	msg := make([]byte, 0, 16+box.Overhead+len(plain))
+	msg = append(msg, "\x07MESSAGE"...)
+	msg = appendCurveNonce(msg, s.nextNonce())
+	nonce := curveNonce("CurveZMQMESSAGEC", s.nonce)
+	return box.SealAfterPrecomputation(msg, plain, &nonce, &s.shared)
+}
+
+// decrypt unwraps a MESSAGE command into the frame's flags and body.
+func (s *curveSession) decrypt(msg []byte) (byte, []byte, error) {
+	if len(msg) < 16+box.Overhead+1 || string(msg[:8]) != "\x07MESSAGE" {
+		return 0, nil, errors.New("expected an encrypted MESSAGE")
+	}
+
+	short := binary.BigEndian.Uint64(msg[8:16])
+	if short <= s.peerNonce {
+		return 0, nil, errors.New("CURVE nonce is not increasing")
+	}
+	nonce := curveNonce("CurveZMQMESSAGES", short)
+	plain, ok := box.OpenAfterPrecomputation(nil, msg[16:], &nonce, &s.shared)
+	if !ok {
+		return 0, nil, errors.New("failed to decrypt MESSAGE")
+	}
+	s.peerNonce = short
+
+	var flags byte
+	if plain[0]&0x01 != 0 {
+		flags |= zmtpFlagMore
+	}
+	if plain[0]&0x02 != 0 {
+		flags |= zmtpFlagCommand
+	}
+	return flags, plain[1:], nil
+}
+
+func (s *curveSession) nextNonce() uint64 {
+	s.nonce++
+	return s.nonce
+}
+
+// curveNonce builds a 24-byte nonce from a 16-byte prefix and a short nonce.
+func curveNonce(prefix string, short uint64) [24]byte {
+	var nonce [24]byte
+	copy(nonce[:], prefix)
+	binary.BigEndian.PutUint64(nonce[16:], short)
+	return nonce
+}
+
+func appendCurveNonce(buf []byte, short uint64) []byte {
+	return binary.BigEndian.AppendUint64(buf, short)
+}
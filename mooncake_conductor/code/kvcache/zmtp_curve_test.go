@@ -0,0 +1,284 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !zmq
+// +build !zmq
+
+package kvcache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// fakeCurveServer runs the server side of the CurveZMQ handshake for a
+// fakePeer, accepting only the clients in allowed. Sessions of accepted
+// connections are sent on sessions.
+type fakeCurveServer struct {
+	public, secret [32]byte
+	allowed        map[[32]byte]bool
+	sessions       chan *fakeCurveSession
+}
+
+// fakeCurveSession encrypts and decrypts the frames of one connection.
+type fakeCurveSession struct {
+	conn   *fakeConn
+	shared [32]byte
+	nonce  uint64
+}
+
+func decodeTestKey(t *testing.T, key string) [32]byte {
+	t.Helper()
+	b, err := z85Decode(key)
+	if err != nil || len(b) != 32 {
+		t.Fatalf("bad test key %q: %v", key, err)
+	}
+	var decoded [32]byte
+	copy(decoded[:], b)
+	return decoded
+}
+
+// newFakeCurvePeer starts a CURVE publisher with the example server keys
+// that knows the example client key.
+func newFakeCurvePeer(t *testing.T) (*fakePeer, *fakeCurveServer) {
+	t.Helper()
+	server := &fakeCurveServer{
+		public:   decodeTestKey(t, testServerPublic),
+		secret:   decodeTestKey(t, testServerSecret),
+		allowed:  map[[32]byte]bool{decodeTestKey(t, testClientPublic): true},
+		sessions: make(chan *fakeCurveSession, 16),
+	}
+	peer := startFakePeer(t, &fakePeer{socketType: "PUB", mechanism: zmtpMechanismCurve, handshake: server.handshake})
+	return peer, server
+}
+
+func testCurveKeys() *CurveKeys {
+	return &CurveKeys{ServerKey: testServerPublic, PublicKey: testClientPublic, SecretKey: testClientSecret}
+}
+
+func fakeNonce(prefix string, rest []byte) *[24]byte {
+	var nonce [24]byte
+	copy(nonce[:], prefix)
+	copy(nonce[len(prefix):], rest)
+	return &nonce
+}
+
+// handshake answers HELLO, INITIATE and sends READY. Like libzmq it drops
+// a HELLO it cannot open and sends ERROR to an unknown client.
+func (s *fakeCurveServer) handshake(conn *fakeConn) error {
+	_, hello, err := readFrame(conn.reader)
+	if err != nil {
+		return err
+	}
+	if len(hello) != 200 || string(hello[:8]) != "\x05HELLO\x01\x00" {
+		return fmt.Errorf("malformed HELLO of %d bytes", len(hello))
+	}
+	var clientTransient [32]byte
+	copy(clientTransient[:], hello[80:112])
+	signature, ok := box.Open(nil, hello[120:], fakeNonce("CurveZMQHELLO---", hello[112:120]), &clientTransient, &s.secret)
+	if !ok || !bytes.Equal(signature, make([]byte, 64)) {
+		return conn.Close()
+	}
+
+	// WELCOME: the fake keeps the connection state itself, so the cookie
+	// is just random bytes
+	serverTransient, serverTransientSecret, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	welcomeNonce := make([]byte, 16)
+	cookie := make([]byte, 96)
+	_, _ = rand.Read(welcomeNonce)
+	_, _ = rand.Read(cookie)
+	welcome := append([]byte("\x07WELCOME"), welcomeNonce...)
+	welcome = box.Seal(welcome, append(serverTransient[:], cookie...), fakeNonce("WELCOME-", welcomeNonce), &clientTransient, &s.secret)
+	if err := conn.writeFrame(zmtpFlagCommand, welcome); err != nil {
+		return err
+	}
+
+	// INITIATE: the client's long-term key, vouch and metadata
+	_, initiate, err := readFrame(conn.reader)
+	if err != nil {
+		return err
+	}
+	if len(initiate) < 113+box.Overhead || string(initiate[:9]) != "\x08INITIATE" || !bytes.Equal(initiate[9:105], cookie) {
+		return errors.New("malformed INITIATE")
+	}
+	plain, ok := box.Open(nil, initiate[113:], fakeNonce("CurveZMQINITIATE", initiate[105:113]), &clientTransient, serverTransientSecret)
+	if !ok || len(plain) < 128 {
+		return errors.New("failed to open INITIATE")
+	}
+	var client [32]byte
+	copy(client[:], plain[:32])
+	vouch, ok := box.Open(nil, plain[48:128], fakeNonce("VOUCH---", plain[32:48]), &client, serverTransientSecret)
+	if !ok || !bytes.Equal(vouch[:32], clientTransient[:]) || !bytes.Equal(vouch[32:], s.public[:]) {
+		return errors.New("invalid vouch")
+	}
+	if !s.allowed[client] {
+		return conn.writeFrame(zmtpFlagCommand, []byte("\x05ERROR\x0eunknown client"))
+	}
+	if conn.props, err = parseProperties(plain[128:]); err != nil {
+		return err
+	}
+
+	session := &fakeCurveSession{conn: conn}
+	box.Precompute(&session.shared, &clientTransient, serverTransientSecret)
+
+	// READY with the publisher's metadata
+	ready := binary.BigEndian.AppendUint64([]byte("\x05READY"), session.nextNonce())
+	ready = box.Seal(ready, appendProperties(nil, map[string]string{"Socket-Type": "PUB"}),
+		fakeNonce("CurveZMQREADY---", ready[6:]), &clientTransient, serverTransientSecret)
+	if err := conn.writeFrame(zmtpFlagCommand, ready); err != nil {
+		return err
+	}
+	s.sessions <- session
+	return nil
+}
+
+func (s *fakeCurveSession) nextNonce() uint64 {
+	s.nonce++
+	return s.nonce
+}
+
+// writeMessage encrypts the frames of one message.
+func (s *fakeCurveSession) writeMessage(frames ...[]byte) error {
+	for i, frame := range frames {
+		var flags byte
+		if i < len(frames)-1 {
+			flags = 0x01
+		}
+		msg := binary.BigEndian.AppendUint64([]byte("\x07MESSAGE"), s.nextNonce())
+		msg = box.SealAfterPrecomputation(msg, append([]byte{flags}, frame...), fakeNonce("CurveZMQMESSAGES", msg[8:]), &s.shared)
+		if err := s.conn.writeFrame(0, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFrame decrypts the next frame and returns its MESSAGE flags.
+func (s *fakeCurveSession) readFrame() (byte, []byte, error) {
+	_ = s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, msg, err := readFrame(s.conn.reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(msg) < 16+box.Overhead+1 || string(msg[:8]) != "\x07MESSAGE" {
+		return 0, nil, fmt.Errorf("expected an encrypted MESSAGE, got %q", msg)
+	}
+	plain, ok := box.OpenAfterPrecomputation(nil, msg[16:], fakeNonce("CurveZMQMESSAGEC", msg[8:16]), &s.shared)
+	if !ok {
+		return 0, nil, errors.New("failed to decrypt MESSAGE")
+	}
+	return plain[0], plain[1:], nil
+}
+
+func (s *fakeCurveServer) next(t *testing.T) *fakeCurveSession {
+	t.Helper()
+	select {
+	case session := <-s.sessions:
+		return session
+	case <-time.After(5 * time.Second):
+		t.Fatal("no client completed the CURVE handshake")
+		return nil
+	}
+}
+
+func TestZMTPCurve(t *testing.T) {
+	pub, server := newFakeCurvePeer(t)
+	keys, err := decodeCurveKeys(testCurveKeys())
+	if err != nil {
+		t.Fatalf("failed to decode keys: %v", err)
+	}
+	sub := newZMTPSocket(zmtpSocketSub, "tcp", pub.address(), zmtpOptions{topics: []string{"kv"}, keys: keys, queueSize: 4})
+	defer sub.close()
+	session := server.next(t)
+
+	if mechanism := string(bytes.TrimRight(session.conn.greeting[12:32], "\x00")); mechanism != zmtpMechanismCurve {
+		t.Errorf("mechanism = %q, want CURVE", mechanism)
+	}
+	if session.conn.props["Socket-Type"] != "SUB" {
+		t.Errorf("INITIATE metadata = %v, want Socket-Type SUB", session.conn.props)
+	}
+
+	// The subscription travels encrypted
+	flags, subscription, err := session.readFrame()
+	if err != nil {
+		t.Fatalf("failed to read subscription: %v", err)
+	}
+	if flags != 0 || string(subscription) != "\x01kv" {
+		t.Errorf("subscription = %q (flags %#x), want \\x01kv", subscription, flags)
+	}
+	waitPeer(t, sub, ConnectionStateConnected)
+
+	payload := bytes.Repeat([]byte{'p'}, 300)
+	if err := session.writeMessage([]byte("kv"), encodeSeq(3), payload); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	msg, err := sub.recv(5 * time.Second)
+	if err != nil {
+		t.Fatalf("recv failed: %v", err)
+	}
+	if len(msg) != 3 || string(msg[0]) != "kv" || !bytes.Equal(msg[1], encodeSeq(3)) || !bytes.Equal(msg[2], payload) {
+		t.Errorf("received %d frames %q, want [kv, 3, 300-byte payload]", len(msg), msg)
+	}
+}
+
+func TestZMTPCurveRejected(t *testing.T) {
+	cases := []struct {
+		name string
+		keys *CurveKeys
+	}{
+		{
+			// The publisher cannot open HELLO and drops the connection
+			name: "wrong server key",
+			keys: &CurveKeys{ServerKey: testClientPublic, PublicKey: testClientPublic, SecretKey: testClientSecret},
+		},
+		{
+			// The publisher answers INITIATE with ERROR
+			name: "unknown client key",
+			keys: &CurveKeys{ServerKey: testServerPublic, PublicKey: testServerPublic, SecretKey: testServerSecret},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pub, _ := newFakeCurvePeer(t)
+			config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+			config.PubEndpoint = "tcp://" + pub.address()
+			config.RouterPort = 0
+			config.Curve = tc.keys
+			transport := &zmtpTransport{config: config}
+			if err := transport.Connect(); err != nil {
+				t.Fatalf("failed to connect: %v", err)
+			}
+			defer transport.Close()
+
+			_, err := transport.Recv(5 * time.Second)
+			if !errors.Is(err, ErrHandshakeRejected) {
+				t.Errorf("Recv = %v, want ErrHandshakeRejected", err)
+			}
+			if state := transport.PeerStatus().State; state == ConnectionStateConnected {
+				t.Error("transport connected despite the rejected handshake")
+			}
+		})
+	}
+}
@@ -0,0 +1,438 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !zmq
+// +build !zmq
+
+package kvcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePeer stands in for a publisher's PUB or ROUTER socket: a loopback
+// listener that runs the server side of a ZMTP 3.0 handshake with every
+// client that connects.
+type fakePeer struct {
+	listener   net.Listener
+	socketType string
+	mechanism  string
+	conns      chan *fakeConn
+
+	// handshake, if set, replaces the NULL READY exchange after greetings
+	handshake func(conn *fakeConn) error
+}
+
+// fakeConn is the server side of one connection to a fakePeer.
+type fakeConn struct {
+	net.Conn
+	reader   *bufio.Reader
+	greeting []byte            // The client's greeting
+	props    map[string]string // Metadata of the client's READY
+}
+
+func newFakePeer(t *testing.T, socketType string) *fakePeer {
+	t.Helper()
+	return startFakePeer(t, &fakePeer{socketType: socketType, mechanism: zmtpMechanismNull})
+}
+
+func startFakePeer(t *testing.T, p *fakePeer) *fakePeer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	p.listener = listener
+	p.conns = make(chan *fakeConn, 16)
+
+	var (
+		mu     sync.Mutex
+		open   []net.Conn
+		closed bool
+		wg     sync.WaitGroup
+	)
+	t.Cleanup(func() {
+		mu.Lock()
+		closed = true
+		_ = listener.Close()
+		for _, conn := range open {
+			_ = conn.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			netConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			open = append(open, netConn)
+			mu.Unlock()
+
+			conn := &fakeConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+			if err := p.accept(conn); err != nil {
+				mu.Lock()
+				if !closed {
+					t.Errorf("fake %s handshake failed: %v", p.socketType, err)
+				}
+				mu.Unlock()
+				_ = conn.Close()
+				continue
+			}
+			select {
+			case p.conns <- conn:
+			default:
+			}
+		}
+	}()
+	return p
+}
+
+// accept exchanges greetings and then runs handshake, by default
+// acceptReady.
+func (p *fakePeer) accept(conn *fakeConn) error {
+	conn.greeting = make([]byte, zmtpGreetingSize)
+	if _, err := io.ReadFull(conn.reader, conn.greeting); err != nil {
+		return err
+	}
+
+	greeting := make([]byte, zmtpGreetingSize)
+	greeting[0], greeting[9], greeting[10] = 0xff, 0x7f, 3
+	copy(greeting[12:32], p.mechanism)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+	if p.handshake != nil {
+		return p.handshake(conn)
+	}
+	return p.acceptReady(conn)
+}
+
+// acceptReady exchanges READY commands, keeping the client's metadata.
+func (p *fakePeer) acceptReady(conn *fakeConn) error {
+	flags, body, err := readFrame(conn.reader)
+	if err != nil {
+		return err
+	}
+	name, data, err := splitCommand(body)
+	if err != nil || flags&zmtpFlagCommand == 0 || name != "READY" {
+		return fmt.Errorf("expected READY, got %q (flags %#x, %v)", name, flags, err)
+	}
+	if conn.props, err = parseProperties(data); err != nil {
+		return err
+	}
+
+	// READY with Socket-Type spelled out byte by byte
+	ready := []byte("\x05READY\x0bSocket-Type")
+	ready = binary.BigEndian.AppendUint32(ready, uint32(len(p.socketType)))
+	ready = append(ready, p.socketType...)
+	return conn.writeFrame(zmtpFlagCommand, ready)
+}
+
+// address returns the tcp endpoint of the peer.
+func (p *fakePeer) address() string {
+	return p.listener.Addr().String()
+}
+
+// next returns the next connection that completed its handshake.
+func (p *fakePeer) next(t *testing.T) *fakeConn {
+	t.Helper()
+	select {
+	case conn := <-p.conns:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no client connected to the fake %s", p.socketType)
+		return nil
+	}
+}
+
+// writeFrame writes one raw frame, long if the body needs it.
+func (c *fakeConn) writeFrame(flags byte, body []byte) error {
+	var frame []byte
+	if len(body) > 255 {
+		frame = binary.BigEndian.AppendUint64([]byte{flags | zmtpFlagLong}, uint64(len(body)))
+	} else {
+		frame = []byte{flags, byte(len(body))}
+	}
+	_, err := c.Write(append(frame, body...))
+	return err
+}
+
+// writeMessage writes the frames of one message.
+func (c *fakeConn) writeMessage(frames ...[]byte) error {
+	for i, frame := range frames {
+		var flags byte
+		if i < len(frames)-1 {
+			flags = zmtpFlagMore
+		}
+		if err := c.writeFrame(flags, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMessage reads the frames of the next message, skipping commands.
+func (c *fakeConn) readMessage() ([][]byte, error) {
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg [][]byte
+	for {
+		flags, body, err := readFrame(c.reader)
+		if err != nil {
+			return nil, err
+		}
+		if flags&zmtpFlagCommand != 0 {
+			continue
+		}
+		msg = append(msg, body)
+		if flags&zmtpFlagMore == 0 {
+			return msg, nil
+		}
+	}
+}
+
+// waitPeer polls a socket until it reaches state.
+func waitPeer(t *testing.T, s *zmtpSocket, state ConnectionState) {
+	t.Helper()
+	waitUntil(t, fmt.Sprintf("the %s socket is %s", s.socketType, state), func() bool {
+		return s.status().State == state
+	})
+}
+
+func TestZMTPSubscribe(t *testing.T) {
+	pub := newFakePeer(t, "PUB")
+	sub := newZMTPSocket(zmtpSocketSub, "tcp", pub.address(), zmtpOptions{topics: []string{"kv", ""}, queueSize: 4})
+	defer sub.close()
+	conn := pub.next(t)
+
+	// Greeting: signature, version 3.0, NULL mechanism, client role
+	greeting := conn.greeting
+	if greeting[0] != 0xff || greeting[9] != 0x7f || greeting[10] != 3 || greeting[11] != 0 {
+		t.Errorf("greeting signature/version = % x", greeting[:12])
+	}
+	if mechanism := string(bytes.TrimRight(greeting[12:32], "\x00")); mechanism != zmtpMechanismNull {
+		t.Errorf("mechanism = %q, want NULL", mechanism)
+	}
+	if greeting[32] != 0 {
+		t.Errorf("as-server = %d, want 0", greeting[32])
+	}
+	if conn.props["Socket-Type"] != "SUB" {
+		t.Errorf("READY metadata = %v, want Socket-Type SUB", conn.props)
+	}
+
+	// SUBSCRIBE, as a ZMTP 3.0 message per topic prefix
+	for _, topic := range []string{"kv", ""} {
+		msg, err := conn.readMessage()
+		if err != nil {
+			t.Fatalf("failed to read subscription: %v", err)
+		}
+		if len(msg) != 1 || !bytes.Equal(msg[0], append([]byte{0x01}, topic...)) {
+			t.Errorf("subscription = %q, want \\x01%s", msg, topic)
+		}
+	}
+	waitPeer(t, sub, ConnectionStateConnected)
+
+	// Multipart messages with short and long frames
+	payload := bytes.Repeat([]byte{'p'}, 300)
+	if err := conn.writeMessage([]byte("kv"), encodeSeq(7), payload); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+	msg, err := sub.recv(5 * time.Second)
+	if err != nil {
+		t.Fatalf("recv failed: %v", err)
+	}
+	if len(msg) != 3 || string(msg[0]) != "kv" || !bytes.Equal(msg[1], encodeSeq(7)) || !bytes.Equal(msg[2], payload) {
+		t.Errorf("received %d frames %q, want [kv, 7, 300-byte payload]", len(msg), msg)
+	}
+}
+
+func TestZMTPReplayRoundTrip(t *testing.T) {
+	pub := newFakePeer(t, "PUB")
+	router := newFakePeer(t, "ROUTER")
+	config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+	config.PubEndpoint = "tcp://" + pub.address()
+	config.ReplayEndpoint = "tcp://" + router.address()
+	transport := &zmtpTransport{config: config}
+	if err := transport.Connect(); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer transport.Close()
+
+	conn := router.next(t)
+	if conn.props["Socket-Type"] != "DEALER" {
+		t.Errorf("READY metadata = %v, want Socket-Type DEALER", conn.props)
+	}
+	waitPeer(t, transport.replaySocket, ConnectionStateConnected)
+
+	if err := transport.RequestReplay(5); err != nil {
+		t.Fatalf("failed to request replay: %v", err)
+	}
+	request, err := conn.readMessage()
+	if err != nil {
+		t.Fatalf("failed to read request: %v", err)
+	}
+	if len(request) != 2 || len(request[0]) != 0 || !bytes.Equal(request[1], encodeSeq(5)) {
+		t.Fatalf("request = %q, want [\"\", 5]", request)
+	}
+
+	// vLLM answers [identity, "", seq, payload]; the DEALER sees no identity
+	for _, seq := range []int64{5, 6, replayEndSeq} {
+		if err := conn.writeMessage([]byte{}, encodeSeq(seq), []byte(fmt.Sprint(seq))); err != nil {
+			t.Fatalf("failed to reply: %v", err)
+		}
+	}
+	for _, seq := range []int64{5, 6, replayEndSeq} {
+		frames, err := transport.RecvReplay(5 * time.Second)
+		if err != nil {
+			t.Fatalf("RecvReplay failed: %v", err)
+		}
+		if len(frames) != 2 || !bytes.Equal(frames[0], encodeSeq(seq)) || string(frames[1]) != fmt.Sprint(seq) {
+			t.Errorf("response = %q, want [%d, %d]", frames, seq, seq)
+		}
+	}
+	if _, err := transport.RecvReplay(10 * time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("RecvReplay after the end = %v, want a timeout", err)
+	}
+}
+
+func TestZMTPHandshakeErrors(t *testing.T) {
+	cases := []struct {
+		name         string
+		peer         *fakePeer
+		wantRejected bool
+	}{
+		{
+			name: "wrong socket type",
+			peer: &fakePeer{socketType: "ROUTER", mechanism: zmtpMechanismNull},
+		},
+		{
+			name: "mechanism mismatch",
+			peer: &fakePeer{socketType: "PUB", mechanism: zmtpMechanismCurve, handshake: func(*fakeConn) error {
+				return nil
+			}},
+			wantRejected: true,
+		},
+		{
+			name: "ERROR command",
+			peer: &fakePeer{socketType: "PUB", mechanism: zmtpMechanismNull, handshake: func(conn *fakeConn) error {
+				return conn.writeFrame(zmtpFlagCommand, []byte("\x05ERROR\x06denied"))
+			}},
+			wantRejected: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			peer := startFakePeer(t, tc.peer)
+			sub := newZMTPSocket(zmtpSocketSub, "tcp", peer.address(), zmtpOptions{queueSize: 1})
+			defer sub.close()
+
+			// Only rejections are reported to the reader; other failures
+			// just retry
+			waitUntil(t, "the socket retries", func() bool { return sub.status().Retries > 0 })
+			if tc.wantRejected {
+				_, err := sub.recv(time.Second)
+				if !errors.Is(err, ErrHandshakeRejected) {
+					t.Errorf("recv = %v, want ErrHandshakeRejected", err)
+				}
+			}
+			if state := sub.status().State; state == ConnectionStateConnected {
+				t.Error("socket connected despite the failed handshake")
+			}
+		})
+	}
+}
+
+// TestZMTPIdleWithoutHeartbeats checks that a quiet publisher is not
+// dropped when heartbeats are disabled, even with a heartbeat timeout set.
+func TestZMTPIdleWithoutHeartbeats(t *testing.T) {
+	pub := newFakePeer(t, "PUB")
+	config := DefaultZMQClientConfig("svc", "127.0.0.1", "")
+	config.PubEndpoint = "tcp://" + pub.address()
+	config.RouterPort = 0
+	config.HeartbeatInterval = 0
+	config.HeartbeatTimeout = 20 * time.Millisecond
+	transport := &zmtpTransport{config: config}
+	if err := transport.Connect(); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer transport.Close()
+
+	pub.next(t)
+	waitPeer(t, transport.subSocket, ConnectionStateConnected)
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case <-pub.conns:
+		t.Error("idle publisher was dropped and dialed again")
+	default:
+	}
+	if status := transport.PeerStatus(); status.State != ConnectionStateConnected {
+		t.Errorf("idle publisher was dropped: %+v", status)
+	}
+}
+
+// TestZMTPHeartbeat checks that PINGs are sent and answered with PONG.
+func TestZMTPHeartbeat(t *testing.T) {
+	pub := newFakePeer(t, "PUB")
+	sub := newZMTPSocket(zmtpSocketSub, "tcp", pub.address(), zmtpOptions{
+		queueSize:         1,
+		heartbeatInterval: 10 * time.Millisecond,
+		heartbeatTimeout:  time.Second,
+	})
+	defer sub.close()
+	conn := pub.next(t)
+
+	if err := conn.writeFrame(zmtpFlagCommand, []byte("\x04PING\x00\x0aping-context")); err != nil {
+		t.Fatalf("failed to send PING: %v", err)
+	}
+	var ping, pong bool
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for !ping || !pong {
+		flags, body, err := readFrame(conn.reader)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if flags&zmtpFlagCommand == 0 {
+			continue
+		}
+		name, data, _ := splitCommand(body)
+		switch name {
+		case "PING":
+			ping = true
+			if ttl := binary.BigEndian.Uint16(data); ttl != 10 {
+				t.Errorf("PING TTL = %d deciseconds, want 10", ttl)
+			}
+		case "PONG":
+			pong = true
+			if string(data) != "ping-context" {
+				t.Errorf("PONG context = %q, want ping-context", data)
+			}
+		}
+	}
+}
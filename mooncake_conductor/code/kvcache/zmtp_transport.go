@@ -0,0 +1,180 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !zmq
+// +build !zmq
+
+package kvcache
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+func init() {
+	SetDefaultTransport(NewZMTPTransport)
+}
+
+// zmtpTransport is the pure-Go Transport used unless built with the zmq
+// tag. It needs neither cgo nor libzmq and talks ZMTP 3.x directly to the
+// publisher's PUB and ROUTER sockets.
+type zmtpTransport struct {
+	config *ZMQClientConfig
+
+	subSocket    *zmtpSocket
+	replaySocket *zmtpSocket
+}
+
+// NewZMTPTransport creates a pure-Go Transport for config.
+func NewZMTPTransport(config *ZMQClientConfig) (Transport, error) {
+	return &zmtpTransport{config: config}, nil
+}
+
+// Connect starts the SUB and DEALER connections. As with libzmq, it does
+// not wait for the publisher: both sockets keep dialing in the background.
+func (t *zmtpTransport) Connect() error {
+	// Ensure clean state
+	_ = t.Close()
+
+	keys, err := decodeCurveKeys(t.config.Curve)
+	if err != nil {
+		return err
+	}
+
+	options := zmtpOptions{
+		keys:      keys,
+		queueSize: EventChannelBufferSize,
+	}
+	if interval := t.config.HeartbeatInterval; interval > 0 {
+		options.heartbeatInterval = interval
+		options.heartbeatTimeout = t.config.HeartbeatTimeout
+		if options.heartbeatTimeout <= 0 {
+			options.heartbeatTimeout = 3 * interval
+		}
+	}
+
+	subNetwork, subAddress, err := zmtpDialAddress(t.config.pubEndpoint())
+	if err != nil {
+		return err
+	}
+	var replayNetwork, replayAddress string
+	if endpoint := t.config.replayEndpoint(); endpoint != "" {
+		if replayNetwork, replayAddress, err = zmtpDialAddress(endpoint); err != nil {
+			return err
+		}
+	}
+
+	subOptions := options
+	subOptions.topics = subscriptionTopics(t.config)
+	t.subSocket = newZMTPSocket(zmtpSocketSub, subNetwork, subAddress, subOptions)
+
+	// Publishers without a replay endpoint only get a SUB socket
+	if replayAddress != "" {
+		t.replaySocket = newZMTPSocket(zmtpSocketDealer, replayNetwork, replayAddress, options)
+	}
+	return nil
+}
+
+// Recv implements Transport.
+func (t *zmtpTransport) Recv(timeout time.Duration) ([][]byte, error) {
+	if t.subSocket == nil {
+		return nil, ErrTransportClosed
+	}
+	return t.subSocket.recv(timeout)
+}
+
+// RequestReplay sends vLLM's replay request ["", start_seq].
+func (t *zmtpTransport) RequestReplay(fromSeq int64) error {
+	if t.replaySocket == nil {
+		return fmt.Errorf("replay socket is nil")
+	}
+
+	// Discard responses left over from an earlier request that timed out
+	t.replaySocket.drain()
+
+	if err := t.replaySocket.send([]byte{}, encodeSeq(fromSeq)); err != nil {
+		return fmt.Errorf("failed to send replay request: %w", err)
+	}
+	return nil
+}
+
+// RecvReplay reads one replay response and strips its empty delimiter frame.
+func (t *zmtpTransport) RecvReplay(timeout time.Duration) ([][]byte, error) {
+	if t.replaySocket == nil {
+		return nil, fmt.Errorf("replay socket is nil")
+	}
+
+	frames, err := t.replaySocket.recv(timeout)
+	if err != nil {
+		return nil, err
+	}
+	if frames == nil {
+		return nil, fmt.Errorf("replay response timed out after %v", timeout)
+	}
+	if len(frames) > 0 && len(frames[0]) == 0 {
+		frames = frames[1:]
+	}
+	return frames, nil
+}
+
+// Notify implements Notifier. The sockets read on their own goroutines,
+// so no reactor is involved.
+func (t *zmtpTransport) Notify() (<-chan struct{}, func()) {
+	if t.subSocket == nil {
+		return nil, nil
+	}
+	return t.subSocket.notify(), func() {}
+}
+
+// PeerStatus implements Transport for the SUB connection.
+func (t *zmtpTransport) PeerStatus() PeerStatus {
+	if t.subSocket == nil {
+		return PeerStatus{State: ConnectionStateDisconnected}
+	}
+	return t.subSocket.status()
+}
+
+// Close closes both sockets.
+func (t *zmtpTransport) Close() error {
+	if t.subSocket != nil {
+		t.subSocket.close()
+		t.subSocket = nil
+	}
+	if t.replaySocket != nil {
+		t.replaySocket.close()
+		t.replaySocket = nil
+	}
+	return nil
+}
+
+// zmtpDialAddress converts an endpoint URL to a net.Dial network and
+// address. inproc endpoints live inside libzmq, so they need the zmq tag.
+func zmtpDialAddress(raw string) (string, string, error) {
+	endpoint, err := ParseEndpoint(raw)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch endpoint.Scheme {
+	case EndpointTCP:
+		return "tcp", net.JoinHostPort(endpoint.Host, strconv.Itoa(endpoint.Port)), nil
+	case EndpointIPC:
+		// Like libzmq, a leading "@" names an abstract socket, which
+		// net.Dial understands as well
+		return "unix", endpoint.Path, nil
+	}
+	return "", "", fmt.Errorf("%s endpoints require the zmq build tag: %s", endpoint.Scheme, raw)
+}
@@ -12,9 +12,6 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-//go:build zmq
-// +build zmq
-
 package kvevent
 
 import (
@@ -42,10 +39,12 @@ func (m *SyncIndexProvider) GetSyncIndexer(ctx context.Context) (SyncIndexer, er
 // staticEventHandler adapts the generic EventHandler interface for StaticManager.
 // It is instantiated in static_manager.go but implemented here to keep files clean.
 type staticEventHandler struct {
-	manager   *StaticManager
-	svcName   string
-	modelName string
-	loraID    int64
+	manager     *StaticManager
+	svcName     string
+	modelName   string
+	loraID      int64
+	dpRank      int
+	stalePolicy StalePolicy
 }
 
 // HandleEvent processes incoming events from.
@@ -69,25 +68,54 @@ func (h *staticEventHandler) HandleEvent(event kvcache.KVEvent) error {
 	// 	return err
 	// }
 
-	slog.Info("Successfully")
+	slog.Debug("Successfully")
 
 	// 4. Dispatch event
 	// The decodes messages into specific event types (BlockStored/Removed).
-	// We pass these directly to the Indexer logic.
+	// We pass these directly to the Indexer logic. Block events arrive by
+	// the thousand, so only clears are logged at Info.
 	switch e := event.(type) {
 	case *kvcache.BlockStoredEvent:
-		slog.Info("[%s] BlockStored: %d blocks", h.svcName, len(e.BlockHashes))
+		slog.Debug("BlockStored", "service", h.svcName, "topic", e.Topic, "blocks", len(e.BlockHashes))
 		return h.handleBlockStored(ctx, e)
 	case *kvcache.BlockRemovedEvent:
-		slog.Info("[%s] BlockRemoved: %d blocks", h.svcName, len(e.BlockHashes))
+		slog.Debug("BlockRemoved", "service", h.svcName, "topic", e.Topic, "blocks", len(e.BlockHashes))
 		return h.handleBlockRemoved(ctx, e)
+	case *kvcache.AllBlocksClearedEvent:
+		slog.Info("AllBlocksCleared", "service", h.svcName, "topic", e.Topic)
+		return h.handleAllBlocksCleared(ctx, e)
 
 	default:
-		slog.Warn("Unknown event type: %T", event)
+		slog.Warn("Unknown event type", "type", fmt.Sprintf("%T", event))
 		return nil
 	}
 }
 
+// HandleStale applies the service's stale policy when its stream goes
+// silent. Under StalePolicyDrop it asks the client to queue a clear, so the
+// entries are dropped by the handler worker in stream order. Recovery needs
+// no action: new events repopulate the index.
+func (h *staticEventHandler) HandleStale(stale bool) bool {
+	if !stale {
+		slog.Info("Service stream recovered", "service", h.svcName, "dp_rank", h.dpRank)
+		return false
+	}
+
+	if h.stalePolicy != StalePolicyDrop {
+		slog.Warn("Service stream is stale, keeping its index entries",
+			"service", h.svcName,
+			"dp_rank", h.dpRank,
+		)
+		return false
+	}
+
+	slog.Warn("Service stream is stale, dropping its index entries",
+		"service", h.svcName,
+		"dp_rank", h.dpRank,
+	)
+	return true
+}
+
 func (h *staticEventHandler) handleBlockStored(ctx context.Context, event *kvcache.BlockStoredEvent) error {
 	// Get sync indexer
 
@@ -97,6 +125,9 @@ func (h *staticEventHandler) handleBlockStored(ctx context.Context, event *kvcac
 		ModelName:       h.modelName,
 		LoraID:          h.loraID,
 		SourcePod:       h.svcName,
+		DPRank:          event.DPRank,
+		Topic:           event.Topic,
+		Medium:          event.Medium,
 		ParentBlockHash: event.ParentBlockHash,
 		Tokens:          convertTokenIDs(event.TokenIDs),
 	}
@@ -117,6 +148,28 @@ func (h *staticEventHandler) handleBlockRemoved(ctx context.Context, event *kvca
 		ModelName:   h.modelName,
 		LoraID:      h.loraID,
 		SourcePod:   h.svcName,
+		DPRank:      event.DPRank,
+		Topic:       event.Topic,
+		Medium:      event.Medium,
+	}
+
+	slog.Debug("Sync event generated (not sent)",
+		"model", syncEvent.ModelName,
+		"lora_id", syncEvent.LoraID,
+	)
+
+	return nil
+}
+
+func (h *staticEventHandler) handleAllBlocksCleared(ctx context.Context, event *kvcache.AllBlocksClearedEvent) error {
+
+	// Convert to sync event
+	syncEvent := AllBlocksClearedEvent{
+		ModelName: h.modelName,
+		LoraID:    h.loraID,
+		SourcePod: h.svcName,
+		DPRank:    event.DPRank,
+		Topic:     event.Topic,
 	}
 
 	slog.Debug("Sync event generated (not sent)",
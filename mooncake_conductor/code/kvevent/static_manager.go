@@ -12,9 +12,6 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-//go:build zmq
-// +build zmq
-
 package kvevent
 
 import (
@@ -36,6 +33,16 @@ type StaticManager struct {
 
 	// Configuration
 	services []ServiceConfig
+	options  ManagerOptions
+
+	// Quarantine for undecodable payloads, shared by all subscriptions
+	deadLetters *kvcache.DeadLetterStore
+
+	// Stream positions saved across restarts (nil without a StateDir)
+	checkpoints *kvcache.CheckpointStore
+
+	// Waits on the sockets of all subscriptions (nil if the transport needs none)
+	reactor kvcache.Reactor
 
 	// Subscriber management
 	// Using utils.SyncMap for type safety with Generics
@@ -52,10 +59,21 @@ type StaticManager struct {
 func NewStaticManager(
 	services []ServiceConfig,
 	syncProvider SyncIndexProvider,
+) *StaticManager {
+	return NewStaticManagerWithOptions(services, syncProvider, ManagerOptions{})
+}
+
+// NewStaticManagerWithOptions creates a new static KV event manager with
+// optional settings.
+func NewStaticManagerWithOptions(
+	services []ServiceConfig,
+	syncProvider SyncIndexProvider,
+	options ManagerOptions,
 ) *StaticManager {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &StaticManager{
 		services:     services,
+		options:      options,
 		syncProvider: syncProvider,
 		ctx:          ctx,
 		cancel:       cancel,
@@ -74,6 +92,26 @@ func (m *StaticManager) Start() error {
 		return fmt.Errorf("sync indexer not ready: %w", err)
 	}
 
+	deadLetters, err := kvcache.NewDeadLetterStore(m.options.DeadLetterCapacity, m.options.DeadLetterSpillDir)
+	if err != nil {
+		return err
+	}
+	m.deadLetters = deadLetters
+
+	if m.options.StateDir != "" {
+		checkpoints, err := kvcache.NewCheckpointStore(m.options.StateDir)
+		if err != nil {
+			return err
+		}
+		m.checkpoints = checkpoints
+	}
+
+	reactor, err := kvcache.NewReactor()
+	if err != nil {
+		return fmt.Errorf("failed to start reactor: %w", err)
+	}
+	m.reactor = reactor
+
 	// 2. Subscribe to all services concurrently
 	var wg sync.WaitGroup
 	errChan := make(chan error, len(m.services))
@@ -130,48 +168,251 @@ func (m *StaticManager) Stop() {
 		)
 		return true
 	})
+
+	// 3. Stop the reactor once no client waits on it
+	if m.reactor != nil {
+		if err := m.reactor.Close(); err != nil {
+			slog.Error("Failed to stop reactor", "error", err)
+		}
+	}
+}
+
+// Status returns the connection state of every subscription, including
+// when disconnected ones will be retried next and which streams are stale.
+func (m *StaticManager) Status() map[string]kvcache.ClientStatus {
+	status := make(map[string]kvcache.ClientStatus)
+	m.subscribers.Range(func(key string, client *kvcache.StaticZMQClient) bool {
+		status[key] = client.Status()
+		return true
+	})
+	return status
+}
+
+// DeadLetters returns the quarantined messages of a subscription, oldest
+// first. An empty key lists all subscriptions.
+func (m *StaticManager) DeadLetters(key string) []kvcache.DeadLetter {
+	if m.deadLetters == nil {
+		return nil
+	}
+	return m.deadLetters.List(key)
+}
+
+// DeadLetterCounts returns how many messages each subscription has quarantined.
+func (m *StaticManager) DeadLetterCounts() map[string]uint64 {
+	if m.deadLetters == nil {
+		return nil
+	}
+	return m.deadLetters.Counts()
 }
 
-// subscribeToService establishes a ZMQ subscription for a single service.
+// RedecodeDeadLetters retries the quarantined messages of a subscription,
+// e.g. after a decoder fix, and returns how many were recovered. Only a
+// batch nothing was handled after is applied; see
+// kvcache.StaticZMQClient.RedecodeDeadLetters.
+func (m *StaticManager) RedecodeDeadLetters(key string) (int, error) {
+	client, ok := m.subscribers.Load(key)
+	if !ok {
+		return 0, fmt.Errorf("unknown subscription: %s", key)
+	}
+	return client.RedecodeDeadLetters()
+}
+
+// subscribeToService establishes ZMQ subscriptions for a single service,
+// one per data parallel rank.
 func (m *StaticManager) subscribeToService(svc ServiceConfig) error {
-	if _, exists := m.subscribers.Load(svc.Name); exists {
+	dpSize := svc.DPSize
+	if dpSize <= 0 {
+		dpSize = 1
+	}
+
+	replayPort, err := serviceReplayPort(svc, dpSize)
+	if err != nil {
+		return err
+	}
+
+	for rank := 0; rank < dpSize; rank++ {
+		if err := m.subscribeToRank(svc, rank, dpSize, replayPort); err != nil {
+			return fmt.Errorf("rank %d: %w", rank, err)
+		}
+	}
+
+	return nil
+}
+
+// serviceReplayPort returns the ROUTER port of rank 0, or 0 if the service
+// has no replay endpoint. The ranks publish on Port..Port+DPSize-1, so with
+// data parallelism the default Port+1 would be rank 1's PUB port and an
+// explicit ReplayPort is required.
+func serviceReplayPort(svc ServiceConfig, dpSize int) (int, error) {
+	if svc.PubEndpoint != "" || svc.ReplayEndpoint != "" {
+		// The ports are not used
+		return 0, nil
+	}
+
+	// Only vLLM publishers have a replay endpoint unless one is configured
+	replayPort := svc.ReplayPort
+	if replayPort == 0 && hasDefaultReplay(svc.Type) {
+		if dpSize > 1 {
+			return 0, fmt.Errorf("replay port is required with data parallel size %d", dpSize)
+		}
+		replayPort = svc.Port + 1
+	}
+
+	if replayPort > 0 && replayPort < svc.Port+dpSize && svc.Port < replayPort+dpSize {
+		return 0, fmt.Errorf("replay ports %d-%d overlap publisher ports %d-%d",
+			replayPort, replayPort+dpSize-1, svc.Port, svc.Port+dpSize-1)
+	}
+	return replayPort, nil
+}
+
+// hasDefaultReplay reports whether publishers of a service type run a
+// replay ROUTER next to their PUB socket by default. SGLang and Mooncake
+// publishers don't; defaulting to Port+1 would make every gap wait out
+// ReplayTimeout before the gap policy applies.
+func hasDefaultReplay(serviceType ServiceType) bool {
+	switch serviceType {
+	case ServiceTypeSGLang, ServiceTypeMooncake:
+		return false
+	}
+	return true
+}
+
+// subscribeToRank establishes a ZMQ subscription for one data parallel rank.
+// vLLM offsets both the PUB and ROUTER ports by the rank.
+func (m *StaticManager) subscribeToRank(svc ServiceConfig, rank, dpSize, replayPort int) error {
+	key := subscriberKey(svc.Name, rank, dpSize)
+	if _, exists := m.subscribers.Load(key); exists {
 		return nil
 	}
 
 	// Create handler instance directly.
 	// The implementation of staticEventHandler is in static_handler.go
 	handler := &staticEventHandler{
-		manager:   m,
-		svcName:   svc.Name,
-		modelName: svc.ModelName,
-		loraID:    svc.LoraID,
+		manager:     m,
+		svcName:     svc.Name,
+		modelName:   svc.ModelName,
+		loraID:      svc.LoraID,
+		dpRank:      rank,
+		stalePolicy: svc.StalePolicy,
+	}
+
+	pubEndpoint, replayEndpoint, err := rankEndpoints(svc, rank, dpSize)
+	if err != nil {
+		return err
+	}
+
+	routerPort := 0
+	if replayPort > 0 {
+		routerPort = replayPort + rank
 	}
 
 	// Configure ZMQ Client
 	zmqConfig := &kvcache.ZMQClientConfig{
-		PodKey:         svc.Name,
+		PodKey:         key,
 		PodIP:          svc.IP,
-		PubPort:        svc.Port,
+		PubPort:        svc.Port + rank,
 		ModelName:      svc.ModelName,
 		PollTimeout:    100 * time.Millisecond,
 		ReplayTimeout:  5 * time.Second,
 		ReconnectDelay: 1 * time.Second,
-		RouterPort:     svc.Port + 1,
+		RouterPort:     routerPort,
+		PubEndpoint:    pubEndpoint,
+		ReplayEndpoint: replayEndpoint,
+		WireFormat:     svc.WireFormat,
+		DPRank:         rank,
+		Topics:         svc.Topics,
+		MaxGapReplay:   kvcache.DefaultMaxGapReplay,
+		GapPolicy:      svc.GapPolicy,
+
+		MaxReconnectDelay:      kvcache.MaxReconnectInterval,
+		ReconnectBackoffFactor: kvcache.ReconnectBackoffFactor,
+		HeartbeatInterval:      kvcache.DefaultHeartbeatInterval,
+		HeartbeatTimeout:       kvcache.DefaultHeartbeatTimeout,
+		ResolveInterval:        kvcache.DefaultResolveInterval,
+		StaleTimeout:           svc.StaleTimeout,
+		QueueSize:              svc.QueueSize,
+		OverflowPolicy:         svc.OverflowPolicy,
+		Reactor:                m.reactor,
+	}
+	if svc.CurveServerKeyFile != "" {
+		keys, err := kvcache.LoadCurveKeys(svc.CurveServerKeyFile, svc.CurveClientKeyFile)
+		if err != nil {
+			return err
+		}
+		zmqConfig.Curve = keys
+	}
+	switch svc.StalePolicy {
+	case "", StalePolicyFreeze, StalePolicyDrop:
+	default:
+		return fmt.Errorf("invalid stale policy: %s", svc.StalePolicy)
+	}
+	if err := kvcache.ValidateConfig(zmqConfig); err != nil {
+		return fmt.Errorf("invalid ZMQ client config: %w", err)
+	}
+
+	// Select the payload decoder for the engine type
+	decoder, err := kvcache.NewDecoder(svc.Type, zmqConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create decoder: %w", err)
 	}
 
 	// Create and start client
-	client := kvcache.NewStaticZMQClient(zmqConfig, handler)
+	client := kvcache.NewStaticZMQClient(zmqConfig, handler, decoder)
+	client.SetDeadLetterStore(m.deadLetters)
+	client.SetCheckpointStore(m.checkpoints)
+	if m.options.Transport != nil {
+		transport, err := m.options.Transport(zmqConfig)
+		if err != nil {
+			return fmt.Errorf("failed to create transport: %w", err)
+		}
+		client.SetTransport(transport)
+	}
 	if err := client.Start(); err != nil {
 		return fmt.Errorf("failed to start ZMQ client: %w", err)
 	}
 
-	m.subscribers.Store(svc.Name, client)
+	m.subscribers.Store(key, client)
 	slog.Info("Successfully subscribed to service",
 		"service_type", svc.Type,
 		"service_name", svc.Name,
 		"service_ip", svc.IP,
-		"service_port", svc.Port,
+		"service_port", zmqConfig.PubPort,
+		"endpoint", pubEndpoint,
+		"dp_rank", rank,
 	)
 
 	return nil
 }
+
+// rankEndpoints returns the endpoint URLs of one data parallel rank, or
+// empty strings if the service is addressed by IP and ports.
+func rankEndpoints(svc ServiceConfig, rank, dpSize int) (string, string, error) {
+	if svc.PubEndpoint == "" && svc.ReplayEndpoint == "" {
+		return "", "", nil
+	}
+	if dpSize <= 1 {
+		return svc.PubEndpoint, svc.ReplayEndpoint, nil
+	}
+
+	var endpoints [2]string
+	for i, raw := range []string{svc.PubEndpoint, svc.ReplayEndpoint} {
+		if raw == "" {
+			continue
+		}
+		endpoint, err := kvcache.OffsetEndpoint(raw, rank)
+		if err != nil {
+			return "", "", err
+		}
+		endpoints[i] = endpoint
+	}
+	return endpoints[0], endpoints[1], nil
+}
+
+// subscriberKey names the subscription of one rank. Services without data
+// parallelism keep their plain name.
+func subscriberKey(name string, rank, dpSize int) string {
+	if dpSize <= 1 {
+		return name
+	}
+	return fmt.Sprintf("%s-dp%d", name, rank)
+}
@@ -0,0 +1,410 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvevent
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"conductor.local/kvcache"
+)
+
+func TestServiceReplayPort(t *testing.T) {
+	cases := []struct {
+		name    string
+		svc     ServiceConfig
+		dpSize  int
+		want    int
+		wantErr bool
+	}{
+		{name: "default", svc: ServiceConfig{Port: 5557}, dpSize: 1, want: 5558},
+		{name: "explicit", svc: ServiceConfig{Port: 5557, ReplayPort: 6000}, dpSize: 1, want: 6000},
+		{name: "sglang without replay", svc: ServiceConfig{Port: 5557, Type: ServiceTypeSGLang}, dpSize: 1, want: 0},
+		{name: "mooncake without replay", svc: ServiceConfig{Port: 5557, Type: ServiceTypeMooncake}, dpSize: 1, want: 0},
+		{name: "mooncake explicit", svc: ServiceConfig{Port: 5557, ReplayPort: 5558, Type: ServiceTypeMooncake}, dpSize: 1, want: 5558},
+		{name: "dp requires replay port", svc: ServiceConfig{Port: 5557}, dpSize: 2, wantErr: true},
+		{name: "dp explicit", svc: ServiceConfig{Port: 5557, ReplayPort: 5561}, dpSize: 4, want: 5561},
+		{name: "dp overlap", svc: ServiceConfig{Port: 5557, ReplayPort: 5560}, dpSize: 4, wantErr: true},
+		{name: "overlap below", svc: ServiceConfig{Port: 5560, ReplayPort: 5557}, dpSize: 4, wantErr: true},
+		{name: "endpoints", svc: ServiceConfig{Port: 5557, PubEndpoint: "tcp://h:1"}, dpSize: 2, want: 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := serviceReplayPort(tc.svc, tc.dpSize)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got port %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("replay port = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+// memoryTransports hands out one kvcache.MemoryTransport per subscription.
+type memoryTransports struct {
+	mu         sync.Mutex
+	transports map[string]*kvcache.MemoryTransport
+}
+
+func (f *memoryTransports) get(key string) *kvcache.MemoryTransport {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.transports == nil {
+		f.transports = make(map[string]*kvcache.MemoryTransport)
+	}
+	transport, ok := f.transports[key]
+	if !ok {
+		transport = kvcache.NewMemoryTransport(64, 64)
+		f.transports[key] = transport
+	}
+	return transport
+}
+
+func (f *memoryTransports) factory(config *kvcache.ZMQClientConfig) (kvcache.Transport, error) {
+	return f.get(config.PodKey), nil
+}
+
+var testService = ServiceConfig{
+	Name:      "vllm-0",
+	IP:        "127.0.0.1",
+	Port:      5557,
+	Type:      ServiceTypeVLLM,
+	ModelName: "model",
+}
+
+func startManager(t *testing.T, transports *memoryTransports, options ManagerOptions, services ...ServiceConfig) *StaticManager {
+	t.Helper()
+	options.Transport = transports.factory
+	m := NewStaticManagerWithOptions(services, SyncIndexProvider{}, options)
+	if err := m.Start(); err != nil {
+		t.Fatalf("failed to start manager: %v", err)
+	}
+	t.Cleanup(m.Stop)
+	return m
+}
+
+func batchPayload(t *testing.T, hash int64) []byte {
+	t.Helper()
+	payload, err := kvcache.EncodeEventBatch(&kvcache.EventBatch{
+		Timestamp: time.Now(),
+		Events: []kvcache.KVEvent{&kvcache.BlockRemovedEvent{
+			Type:        kvcache.EventTypeBlockRemoved,
+			BlockHashes: []kvcache.BlockHash{kvcache.Int64BlockHash(hash)},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode batch: %v", err)
+	}
+	return payload
+}
+
+// waitStatus polls the status of a subscription until cond holds.
+func waitStatus(t *testing.T, m *StaticManager, key, what string, cond func(kvcache.ClientStatus) bool) kvcache.ClientStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := m.Status()[key]
+		if cond(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s: %+v", what, status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitConnected(t *testing.T, transport *kvcache.MemoryTransport) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !transport.Connected() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the transport to connect")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStaticManagerGapReplay(t *testing.T) {
+	transports := &memoryTransports{}
+	m := startManager(t, transports, ManagerOptions{}, testService)
+	transport := transports.get(testService.Name)
+	waitConnected(t, transport)
+
+	transport.Publish(nil, 0, batchPayload(t, 0))
+	transport.Drop(1, batchPayload(t, 1))
+	transport.Drop(2, batchPayload(t, 2))
+	transport.Publish(nil, 3, batchPayload(t, 3))
+
+	status := waitStatus(t, m, testService.Name, "seq 3 is handled", func(s kvcache.ClientStatus) bool { return s.HandledSeq == 3 })
+	if status.PublisherRestarts != 0 {
+		t.Errorf("restarts = %d, want 0", status.PublisherRestarts)
+	}
+	if requests := transport.ReplayRequests(); len(requests) != 1 || requests[0] != 1 {
+		t.Errorf("replay requests = %v, want [1]", requests)
+	}
+}
+
+func TestStaticManagerGapNotReplayable(t *testing.T) {
+	transports := &memoryTransports{}
+	svc := testService
+	svc.GapPolicy = kvcache.GapPolicyIgnore
+	m := startManager(t, transports, ManagerOptions{}, svc)
+	transport := transports.get(svc.Name)
+	waitConnected(t, transport)
+
+	// The publisher buffers seq 1 no more, so the replay from 1 is rejected
+	transport.Publish(nil, 0, batchPayload(t, 0))
+	for seq := int64(1); seq < 70; seq++ {
+		transport.Drop(seq, batchPayload(t, seq))
+	}
+	transport.Publish(nil, 70, batchPayload(t, 70))
+
+	waitStatus(t, m, svc.Name, "seq 70 is handled", func(s kvcache.ClientStatus) bool { return s.HandledSeq == 70 })
+	if requests := transport.ReplayRequests(); len(requests) != 1 || requests[0] != 1 {
+		t.Errorf("replay requests = %v, want [1]", requests)
+	}
+}
+
+func TestStaticManagerReconnect(t *testing.T) {
+	transports := &memoryTransports{}
+	m := startManager(t, transports, ManagerOptions{}, testService)
+	transport := transports.get(testService.Name)
+	waitConnected(t, transport)
+
+	transport.Publish(nil, 0, batchPayload(t, 0))
+	waitStatus(t, m, testService.Name, "seq 0 is handled", func(s kvcache.ClientStatus) bool { return s.HandledSeq == 0 })
+
+	// Batches published while the connection is down are replayed
+	transport.Disconnect(errors.New("connection reset"))
+	status := waitStatus(t, m, testService.Name, "the disconnect is noticed", func(s kvcache.ClientStatus) bool {
+		return s.State == kvcache.ConnectionStateDisconnected && !s.NextRetry.IsZero()
+	})
+	if status.LastError != "receive error: connection reset" {
+		t.Errorf("last error = %q", status.LastError)
+	}
+	transport.Publish(nil, 1, batchPayload(t, 1))
+	transport.Publish(nil, 2, batchPayload(t, 2))
+
+	status = waitStatus(t, m, testService.Name, "the missed batches are replayed", func(s kvcache.ClientStatus) bool { return s.HandledSeq == 2 })
+	if status.ReconnectAttempts != 0 || !status.NextRetry.IsZero() {
+		t.Errorf("reconnect attempts = %d, next retry = %v after reconnecting", status.ReconnectAttempts, status.NextRetry)
+	}
+	if transport.Connects() != 2 {
+		t.Errorf("connects = %d, want 2", transport.Connects())
+	}
+	if requests := transport.ReplayRequests(); len(requests) != 1 || requests[0] != 1 {
+		t.Errorf("replay requests = %v, want [1]", requests)
+	}
+}
+
+func TestStaticManagerCheckpointResume(t *testing.T) {
+	// checkpoint runs a manager until seq 2 is handled and stops it
+	checkpoint := func(t *testing.T, dir string) {
+		transports := &memoryTransports{}
+		m := startManager(t, transports, ManagerOptions{StateDir: dir}, testService)
+		transport := transports.get(testService.Name)
+		waitConnected(t, transport)
+		for seq := int64(0); seq < 3; seq++ {
+			transport.Publish(nil, seq, batchPayload(t, seq))
+		}
+		waitStatus(t, m, testService.Name, "seq 2 is handled", func(s kvcache.ClientStatus) bool { return s.HandledSeq == 2 })
+		m.Stop()
+	}
+
+	t.Run("publisher kept running", func(t *testing.T) {
+		dir := t.TempDir()
+		checkpoint(t, dir)
+
+		transports := &memoryTransports{}
+		transport := transports.get(testService.Name)
+		for seq := int64(0); seq < 6; seq++ {
+			transport.Drop(seq, batchPayload(t, seq))
+		}
+		m := startManager(t, transports, ManagerOptions{StateDir: dir}, testService)
+
+		status := waitStatus(t, m, testService.Name, "the stream is resumed", func(s kvcache.ClientStatus) bool { return s.HandledSeq == 5 })
+		if status.Duplicates != 0 || status.PublisherRestarts != 0 {
+			t.Errorf("duplicates = %d, restarts = %d; want none", status.Duplicates, status.PublisherRestarts)
+		}
+		if requests := transport.ReplayRequests(); len(requests) != 1 || requests[0] != 3 {
+			t.Errorf("replay requests = %v, want [3]", requests)
+		}
+	})
+
+	// A publisher restarted while the manager was down has nothing past the
+	// checkpoint to replay, and its live stream is not ahead of it
+	for _, live := range []int64{1, 2} {
+		t.Run(fmt.Sprintf("publisher restarted at %d", live), func(t *testing.T) {
+			dir := t.TempDir()
+			checkpoint(t, dir)
+
+			transports := &memoryTransports{}
+			transport := transports.get(testService.Name)
+			for seq := int64(0); seq < live; seq++ {
+				transport.Drop(seq, batchPayload(t, seq))
+			}
+			m := startManager(t, transports, ManagerOptions{StateDir: dir}, testService)
+			waitConnected(t, transport)
+			waitUntilReplayed(t, transport, 1)
+			transport.Publish(nil, live, batchPayload(t, live))
+
+			status := waitStatus(t, m, testService.Name, "the restart is handled", func(s kvcache.ClientStatus) bool {
+				return s.PublisherRestarts == 1 && s.HandledSeq == live
+			})
+			if status.Duplicates != 0 {
+				t.Errorf("duplicates = %d, want 0", status.Duplicates)
+			}
+			if requests := transport.ReplayRequests(); len(requests) != 2 || requests[0] != 3 || requests[1] != 0 {
+				t.Errorf("replay requests = %v, want [3 0]", requests)
+			}
+		})
+	}
+}
+
+// waitUntilReplayed waits until a transport received n replay requests.
+func waitUntilReplayed(t *testing.T, transport *kvcache.MemoryTransport, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(transport.ReplayRequests()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d replay requests", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStaticManagerSequenceRegression(t *testing.T) {
+	transports := &memoryTransports{}
+	m := startManager(t, transports, ManagerOptions{}, testService)
+	transport := transports.get(testService.Name)
+	waitConnected(t, transport)
+
+	for seq := int64(0); seq < 100; seq++ {
+		transport.Publish(nil, seq, batchPayload(t, seq))
+	}
+	waitStatus(t, m, testService.Name, "seq 99 is handled", func(s kvcache.ClientStatus) bool { return s.HandledSeq == 99 })
+
+	// A restarted publisher far from 0 still restarts: its batches are not
+	// skipped until it passes the old sequence
+	transport.Publish(nil, 50, batchPayload(t, 50))
+	status := waitStatus(t, m, testService.Name, "the restart is handled", func(s kvcache.ClientStatus) bool {
+		return s.PublisherRestarts == 1 && s.HandledSeq == 50
+	})
+	if status.Duplicates != 0 {
+		t.Errorf("duplicates = %d, want 0", status.Duplicates)
+	}
+
+	// A publisher counting from 0 again restarted
+	transport.Publish(nil, 0, batchPayload(t, 0))
+	status = waitStatus(t, m, testService.Name, "the second restart is handled", func(s kvcache.ClientStatus) bool { return s.PublisherRestarts == 2 })
+	if status.LastSeq != 0 {
+		t.Errorf("last sequence = %d, want 0", status.LastSeq)
+	}
+}
+
+func TestStaticManagerStop(t *testing.T) {
+	transports := &memoryTransports{}
+	svc := testService
+	svc.DPSize = 2
+	svc.ReplayPort = 5600
+	m := startManager(t, transports, ManagerOptions{}, svc)
+
+	for _, key := range []string{"vllm-0-dp0", "vllm-0-dp1"} {
+		transport := transports.get(key)
+		waitConnected(t, transport)
+		for seq := int64(0); seq < 32; seq++ {
+			transport.Publish(nil, seq, batchPayload(t, seq))
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+	m.Stop() // Stopping twice is harmless
+
+	for _, key := range []string{"vllm-0-dp0", "vllm-0-dp1"} {
+		if transports.get(key).Connected() {
+			t.Errorf("%s is still connected", key)
+		}
+	}
+	handler := &staticEventHandler{manager: m, svcName: svc.Name}
+	if err := handler.HandleEvent(&kvcache.AllBlocksClearedEvent{}); err == nil {
+		t.Error("handler accepted an event after Stop")
+	}
+}
+
+// TestStaticManagerStale stops publishing past StaleTimeout and checks the
+// status flag, and that only StalePolicyDrop asks for the entries to be
+// cleared.
+func TestStaticManagerStale(t *testing.T) {
+	for _, tc := range []struct {
+		policy    StalePolicy
+		wantClear bool
+	}{
+		{policy: "", wantClear: false},
+		{policy: StalePolicyFreeze, wantClear: false},
+		{policy: StalePolicyDrop, wantClear: true},
+	} {
+		t.Run(fmt.Sprintf("policy %q", tc.policy), func(t *testing.T) {
+			handler := &staticEventHandler{svcName: testService.Name, stalePolicy: tc.policy}
+			if clear := handler.HandleStale(true); clear != tc.wantClear {
+				t.Errorf("HandleStale(true) = %v, want %v", clear, tc.wantClear)
+			}
+			if handler.HandleStale(false) {
+				t.Error("HandleStale(false) asked for a clear")
+			}
+
+			transports := &memoryTransports{}
+			svc := testService
+			svc.StaleTimeout = 50 * time.Millisecond
+			svc.StalePolicy = tc.policy
+			m := startManager(t, transports, ManagerOptions{}, svc)
+			transport := transports.get(svc.Name)
+			waitConnected(t, transport)
+
+			transport.Publish(nil, 0, batchPayload(t, 0))
+			waitStatus(t, m, svc.Name, "seq 0 is handled", func(s kvcache.ClientStatus) bool { return s.HandledSeq == 0 })
+			status := waitStatus(t, m, svc.Name, "the stream goes stale", func(s kvcache.ClientStatus) bool { return s.Stale })
+			if status.State != kvcache.ConnectionStateStale {
+				t.Errorf("state = %s, want %s", status.State, kvcache.ConnectionStateStale)
+			}
+
+			transport.Publish(nil, 1, batchPayload(t, 1))
+			status = waitStatus(t, m, svc.Name, "the stream recovers", func(s kvcache.ClientStatus) bool { return !s.Stale })
+			if status.State != kvcache.ConnectionStateConnected || status.LastSeq != 1 {
+				t.Errorf("status after recovering = %+v", status)
+			}
+		})
+	}
+}
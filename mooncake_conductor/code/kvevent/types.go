@@ -14,40 +14,135 @@
 
 package kvevent
 
-// ServiceType defines the type of service (vLLM or Mooncake)
-type ServiceType string
+import (
+	"time"
+
+	"conductor.local/kvcache"
+)
+
+// ServiceType defines the type of service (vLLM, Mooncake or SGLang).
+// It selects the kvcache.Decoder used for the service's events.
+type ServiceType = kvcache.ServiceType
 
 const (
-	ServiceTypeVLLM     ServiceType = "vLLM"
-	ServiceTypeMooncake ServiceType = "Mooncake"
+	ServiceTypeVLLM     = kvcache.ServiceTypeVLLM
+	ServiceTypeMooncake = kvcache.ServiceTypeMooncake
+	ServiceTypeSGLang   = kvcache.ServiceTypeSGLang
 )
 
 // ServiceConfig defines static connection information for a service instance.
 // It replaces the dynamic Pod discovery mechanism from Kubernetes.
 type ServiceConfig struct {
-	Name      string      // Unique identifier (e.g., "vllm-worker-0")
-	IP        string      // Service IP address
-	Port      int         // ZMQ publisher port (e.g., 5557)
-	Type      ServiceType // Service type (vLLM/Mooncake)
-	ModelName string      // Model name hosted by the service
-	LoraID    int64       // LoRA ID (-1 if not applicable)
+	Name       string      // Unique identifier (e.g., "vllm-worker-0")
+	IP         string      // Service IP address or hostname
+	Port       int         // ZMQ publisher port (e.g., 5557)
+	ReplayPort int         // ZMQ replay (ROUTER) port; 0 means Port+1 (none for SGLang and Mooncake), required if DPSize > 1
+	DPSize     int         // Data parallel size; rank r publishes on Port+r and ReplayPort+r, which must not overlap
+	Type       ServiceType // Service type (vLLM/Mooncake/SGLang)
+	ModelName  string      // Model name hosted by the service
+	LoraID     int64       // LoRA ID (-1 if not applicable)
+
+	// PubEndpoint and ReplayEndpoint, if set, replace IP and the ports with
+	// endpoint URLs (tcp://host:port, ipc:///path or inproc://name, see
+	// kvcache.ParseEndpoint). The replay endpoint is then only used if set.
+	// Like vLLM, rank r offsets tcp ports by r and suffixes inproc names
+	// with "_dp<r>"; ipc endpoints only serve a single rank.
+	PubEndpoint    string
+	ReplayEndpoint string
+
+	// Topics lists the publisher topic prefixes to subscribe to. Empty
+	// subscribes to every topic. Replayed batches carry no topic, so gaps
+	// are not replayed while Topics is set; GapPolicy handles them at once.
+	// A publisher that shares one sequence across topics shows gaps whenever
+	// only some are subscribed, so set GapPolicy to kvcache.GapPolicyIgnore
+	// for it.
+	Topics []string
+
+	// CURVE encryption, enabled when CurveServerKeyFile is set.
+	// CurveServerKeyFile holds the publisher's public key and CurveClientKeyFile
+	// the client key pair, both as zcert certificates (see kvcache.LoadCurveKeys).
+	CurveServerKeyFile string
+	CurveClientKeyFile string
+
+	// WireFormat pins the vLLM event layout (e.g. "vllm-0.10").
+	// Empty auto-detects the layout from each event's tuple arity.
+	WireFormat string
+
+	// GapPolicy decides what happens to the service's index entries when
+	// missed batches cannot be replayed (default purge).
+	GapPolicy kvcache.GapPolicy
+
+	// StaleTimeout marks the service stale when it publishes nothing for
+	// that long (0 disables the watchdog). StalePolicy decides what happens
+	// to its index entries meanwhile (default freeze).
+	StaleTimeout time.Duration
+	StalePolicy  StalePolicy
+
+	// QueueSize bounds the batches waiting for the indexer (default
+	// kvcache.EventChannelBufferSize). OverflowPolicy decides what happens
+	// when they don't fit (default block).
+	QueueSize      int
+	OverflowPolicy kvcache.OverflowPolicy
+}
+
+// StalePolicy decides what happens to a stale service's index entries
+type StalePolicy string
+
+const (
+	// StalePolicyFreeze keeps the entries and routing until the stream
+	// recovers; an idle engine publishes nothing either
+	StalePolicyFreeze StalePolicy = "freeze"
+
+	// StalePolicyDrop clears the entries, since the engine and its cache
+	// may be gone
+	StalePolicyDrop StalePolicy = "drop"
+)
+
+// ManagerOptions holds optional StaticManager settings. Zero values select defaults.
+type ManagerOptions struct {
+	// DeadLetterCapacity bounds the in-memory quarantine of undecodable messages
+	DeadLetterCapacity int
+	// DeadLetterSpillDir, if set, keeps quarantined messages on disk, rotated at
+	// kvcache.DefaultDeadLetterSpillBytes per subscription
+	DeadLetterSpillDir string
+	// StateDir, if set, holds a sequence checkpoint per subscription, so a
+	// restarted manager resumes each stream with a replay
+	StateDir string
+	// Transport, if set, creates the connection of each subscription instead
+	// of the default libzmq transport (e.g. kvcache.MemoryTransport in tests)
+	Transport kvcache.TransportFactory
 }
 
 // Event types for sync indexer
 // These types mirror the kvcache event types but with necessary conversions:
 // - TokenIDs ([][]int32) are converted to Tokens ([][]byte) for storage
+// - Block hashes keep the engine's representation (int64 or raw bytes)
 type BlockStoredEvent struct {
-	BlockHashes     []int64
+	BlockHashes     []kvcache.BlockHash
 	ModelName       string
 	LoraID          int64
 	SourcePod       string
-	ParentBlockHash *int64
+	DPRank          int
+	Topic           string // Publisher topic ("" if replayed)
+	Medium          string // Storage tier, see kvcache Medium constants
+	ParentBlockHash *kvcache.BlockHash
 	Tokens          [][]byte // Converted from [][]int32 TokenIDs
 }
 
 type BlockRemovedEvent struct {
-	BlockHashes []int64
+	BlockHashes []kvcache.BlockHash
 	ModelName   string
 	LoraID      int64
 	SourcePod   string
+	DPRank      int
+	Topic       string
+	Medium      string
+}
+
+type AllBlocksClearedEvent struct {
+	ModelName string
+	LoraID    int64
+	SourcePod string
+	DPRank    int
+	Topic     string
 }
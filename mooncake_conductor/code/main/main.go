@@ -51,9 +51,9 @@ func (i *DemoIndexer) ProcessBlockRemoved(ctx context.Context, event interface{}
 	return nil
 }
 
-func fmtFirstHash(hashes []int64) string {
+func fmtFirstHash(hashes []kvcache.BlockHash) string {
 	if len(hashes) > 0 {
-		return fmt.Sprintf("%d", hashes[0])
+		return hashes[0].String()
 	}
 	return "none"
 }
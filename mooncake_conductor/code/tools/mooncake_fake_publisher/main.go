@@ -0,0 +1,102 @@
+// Copyright 2025 The AIBrix Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build zmq
+// +build zmq
+
+// Command mooncake_fake_publisher emulates the Mooncake Store event stream so
+// a conductor-ctrl configured with a ServiceTypeMooncake service can be tested
+// locally. It publishes [topic, seq, payload] messages where payload is
+// encoded with kvcache.EncodeMooncakeBatch. It needs libzmq to bind; without
+// it, TestMooncakeFakePublisher in kvcache drives the same stream through a
+// MemoryTransport.
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"log/slog"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	zmq "github.com/pebbe/zmq4"
+
+	"conductor.local/kvcache"
+)
+
+func main() {
+	endpoint := flag.String("endpoint", "tcp://*:5557", "PUB endpoint to bind")
+	topic := flag.String("topic", "", "topic frame for each message")
+	interval := flag.Duration("interval", time.Second, "delay between batches")
+	flag.Parse()
+
+	pub, err := zmq.NewSocket(zmq.PUB)
+	if err != nil {
+		slog.Error("Failed to create PUB socket", "error", err)
+		os.Exit(1)
+	}
+	defer pub.Close()
+
+	if err := pub.Bind(*endpoint); err != nil {
+		slog.Error("Failed to bind", "endpoint", *endpoint, "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Fake Mooncake publisher bound", "endpoint", *endpoint)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	var (
+		seq  uint64
+		live []string
+	)
+	for {
+		select {
+		case <-sigChan:
+			return
+		case <-ticker.C:
+		}
+
+		// Put a new object, and evict the oldest one now and then
+		key := strconv.FormatInt(rand.Int63(), 10)
+		live = append(live, key)
+		notifications := []kvcache.MooncakeNotification{
+			{Op: kvcache.MooncakeOpPut, Keys: []string{key}, Tier: kvcache.MooncakeTierMemory},
+		}
+		if len(live) > 8 {
+			notifications = append(notifications, kvcache.MooncakeNotification{
+				Op: kvcache.MooncakeOpRemove, Keys: live[:1], Tier: kvcache.MooncakeTierMemory,
+			})
+			live = live[1:]
+		}
+
+		seqBytes := make([]byte, 8)
+		binary.BigEndian.PutUint64(seqBytes, seq)
+		payload := kvcache.EncodeMooncakeBatch(time.Now(), notifications)
+
+		if _, err := pub.SendMessage(*topic, seqBytes, payload); err != nil {
+			slog.Error("Failed to publish", "seq", seq, "error", err)
+			continue
+		}
+		slog.Info("Published", "seq", seq, "notifications", len(notifications))
+		seq++
+	}
+}